@@ -2,8 +2,16 @@ package dbmigrator
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // HandleMigratorCommand is intended to be hooked into main.go
@@ -20,41 +28,445 @@ import (
 //
 // Param: args - os.Args[1:] from main.go
 //
-// Returns: boolean indicating if a command was actionable
-// Not indicative of success or failure.
+// Returns: boolean indicating if the args were a migrator command,
+// and the error the command failed with. Invalid usage of a migrator command
+// prints the usage of the command and returns an error wrapping ErrUsage.
 func HandleMigratorCommand(
 	db *sql.DB,
 	migrationFS fs.FS,
 	migrationDir string,
-	args ...string) bool {
+	args ...string) (bool, error) {
+	return handleMigratorCommand(db, migrationFS, migrationDir, migrationDir, args...)
+}
+
+// HandleMigratorCommandDir works like HandleMigratorCommand
+// for migrations read from a directory on disk rather than an fs.FS.
+//
+// Param: migrationDir - path of the migrations directory on disk
+func HandleMigratorCommandDir(
+	db *sql.DB,
+	migrationDir string,
+	args ...string) (bool, error) {
+	return handleMigratorCommand(db, os.DirFS(migrationDir), ".", migrationDir, args...)
+}
+
+// commandEnv is what a migrate command runs against
+type commandEnv struct {
+	db           *sql.DB
+	migrationFS  fs.FS
+	migrationDir string
+	diskDir      string // Commands that write migration files write them here
+	out          io.Writer
+}
+
+// commandOptions holds the flags of a migrate command
+type commandOptions struct {
+	dryRun bool
+	to     int
+	yes    bool
+	format string
+	phase  Phase
+}
+
+// migrateCommand describes a `migrate` subcommand
+type migrateCommand struct {
+	name        string
+	args        []string // Required positional arguments
+	flags       []string // Supported flags: dry-run, to, yes, format, phase
+	description string
+	run         func(env commandEnv, opts commandOptions, args []string) error
+}
+
+var migrateCommands = []migrateCommand{
+	{
+		name:        "up",
+		flags:       []string{"to", "phase", "dry-run", "format"},
+		description: "Apply all new database migrations, or only the pre or post phase sections with --phase.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			target := max(opts.to, 0)
+			if opts.phase != PhaseAll {
+				if target != 0 {
+					return fmt.Errorf("%w: --phase can not be combined with --to", ErrUsage)
+				}
+				if opts.dryRun {
+					plan, err := PlanUpPhase(env.db, env.migrationFS, env.migrationDir, opts.phase)
+					if err != nil {
+						return err
+					}
+					return writeOutput(env.out, opts.format, plan)
+				}
+				return MigrateUpPhase(env.db, env.migrationFS, env.migrationDir, opts.phase)
+			}
+			if opts.dryRun {
+				plan, err := PlanUp(env.db, env.migrationFS, env.migrationDir, target)
+				if err != nil {
+					return err
+				}
+				return writeOutput(env.out, opts.format, plan)
+			}
+			return MigrateUpTo(env.db, env.migrationFS, env.migrationDir, target)
+		},
+	},
+	{
+		name:        "down",
+		flags:       []string{"to", "dry-run", "format"},
+		description: "Rollback a single database migration, or every migration above --to.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			if opts.dryRun {
+				plan, err := PlanDown(env.db, env.migrationFS, env.migrationDir, opts.to)
+				if err != nil {
+					return err
+				}
+				return writeOutput(env.out, opts.format, plan)
+			}
+			if opts.to >= 0 {
+				return MigrateDownTo(env.db, env.migrationFS, env.migrationDir, opts.to)
+			}
+			return MigrateDown(env.db, env.migrationFS, env.migrationDir)
+		},
+	},
+	{
+		name:        "plan",
+		flags:       []string{"to", "format"},
+		description: "Show the migrations `migrate up` would apply.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			plan, err := PlanUp(env.db, env.migrationFS, env.migrationDir, max(opts.to, 0))
+			if err != nil {
+				return err
+			}
+			return writeOutput(env.out, opts.format, plan)
+		},
+	},
+	{
+		name:        "redo",
+		description: "Rollback the latest migration and apply it again.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			return Redo(env.db, env.migrationFS, env.migrationDir)
+		},
+	},
+	{
+		name:        "reset",
+		flags:       []string{"yes", "dry-run", "format"},
+		description: "Rollback every migration.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			if opts.dryRun {
+				plan, err := PlanDown(env.db, env.migrationFS, env.migrationDir, 0)
+				if err != nil {
+					return err
+				}
+				return writeOutput(env.out, opts.format, plan)
+			}
+			return Reset(env.db, env.migrationFS, env.migrationDir, opts.yes)
+		},
+	},
+	{
+		name:        "fresh",
+		flags:       []string{"yes"},
+		description: "Drop every object in the schema and apply all migrations.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			return Fresh(env.db, env.migrationFS, env.migrationDir, opts.yes)
+		},
+	},
+	{
+		name:        "status",
+		flags:       []string{"format"},
+		description: "Show installed, available and pending migrations.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			status, err := Status(env.db, env.migrationFS, env.migrationDir)
+			if err != nil {
+				return err
+			}
+			return writeOutput(env.out, opts.format, status)
+		},
+	},
+	{
+		name:        "history",
+		flags:       []string{"format"},
+		description: "List every migration operation recorded on the database.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			entries, err := History(env.db)
+			if err != nil {
+				return err
+			}
+			if entries == nil {
+				entries = []HistoryEntry{}
+			}
+			return writeOutput(env.out, opts.format, historyEntries(entries))
+		},
+	},
+	{
+		name:        "verify",
+		flags:       []string{"format"},
+		description: "Check applied migrations were not modified since they were applied.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			result, err := Verify(env.db, env.migrationFS, env.migrationDir)
+			if err != nil {
+				return err
+			}
+			if err := writeOutput(env.out, opts.format, result); err != nil {
+				return err
+			}
+			if !result.Valid() {
+				return errors.New("applied migrations were modified or are missing")
+			}
+			return nil
+		},
+	},
+	{
+		name:        "baseline",
+		args:        []string{"version"},
+		description: "Record migrations up to version as applied without running them.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			version, err := parseVersionArg(args[0])
+			if err != nil {
+				return err
+			}
+			return Baseline(env.db, env.migrationFS, env.migrationDir, version)
+		},
+	},
+	{
+		name:        "force",
+		args:        []string{"version"},
+		description: "Change the recorded version without running migrations.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			version, err := parseVersionArg(args[0])
+			if err != nil {
+				return err
+			}
+			return Force(env.db, env.migrationFS, env.migrationDir, version)
+		},
+	},
+	{
+		name:        "validate",
+		description: "Check all migration files without touching the database.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			if _, err := ValidateMigrations(env.migrationFS, env.migrationDir); err != nil {
+				return fmt.Errorf("invalid migrations: %w", err)
+			}
+			_, err := fmt.Fprintln(env.out, "Migrations are valid.")
+			return err
+		},
+	},
+	{
+		name:        "squash",
+		args:        []string{"upto"},
+		description: "Concatenate migrations up to version upto into a single baseline migration and archive the originals.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			upTo, err := parseVersionArg(args[0])
+			if err != nil {
+				return err
+			}
+			// Split the migrations following the dialect of the database
+			queries, err := resolveQueries(SQLExecutor(env.db))
+			if err != nil {
+				return err
+			}
+			_, err = squash(env.diskDir, upTo, queries.SQLSyntax)
+			return err
+		},
+	},
+	{
+		name:        "renumber",
+		flags:       []string{"dry-run"},
+		description: "Rename unapplied migrations with conflicting or out of order versions to the next free versions.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			if opts.dryRun {
+				renames, err := PlanRenumber(env.db, env.diskDir)
+				if err != nil {
+					return err
+				}
+				for _, rename := range renames {
+					if _, err := fmt.Fprintf(env.out, "%s -> %s\n", rename.From, rename.To); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			_, err := Renumber(env.db, env.diskDir)
+			return err
+		},
+	},
+	{
+		name:        "import",
+		args:        []string{"goose|golang-migrate|flyway", "sourceDir"},
+		description: "Convert another tool's migrations into the migrations directory and record the versions it had applied.",
+		run: func(env commandEnv, opts commandOptions, args []string) error {
+			return Import(env.db, ImportSource(args[0]), os.DirFS(args[1]), ".", env.diskDir)
+		},
+	},
+}
+
+// handleMigratorCommand handles a command with migrations read from migrationDir in migrationFS.
+// Commands that write migration files write them to diskDir.
+func handleMigratorCommand(
+	db *sql.DB,
+	migrationFS fs.FS,
+	migrationDir string,
+	diskDir string,
+	args ...string) (bool, error) {
 	if len(args) == 0 {
-		return false
+		return false, nil
 	}
 	switch args[0] {
 	case "help":
 		fmt.Println(GetHelpString())
-		return true
+		return true, nil
 	case "migrate":
 		if len(args) < 2 {
-			return false
-		}
-		switch args[1] {
-		case "up":
-			<-MigrateUpCh(db, migrationFS, migrationDir)
-			return true
-		case "down":
-			<-MigrateDownCh(db, migrationFS, migrationDir)
-			return true
-		default:
-			return false
+			fmt.Fprintln(os.Stderr, "Usage:"+GetHelpString())
+			return true, fmt.Errorf("%w: missing migrate command", ErrUsage)
+		}
+		if command := findMigrateCommand(args[1]); command != nil {
+			env := commandEnv{
+				db:           db,
+				migrationFS:  migrationFS,
+				migrationDir: migrationDir,
+				diskDir:      diskDir,
+				out:          os.Stdout,
+			}
+			return true, command.execute(env, args[2:])
 		}
+		fmt.Fprintln(os.Stderr, "Usage:"+GetHelpString())
+		return true, fmt.Errorf("%w: unknown migrate command %q", ErrUsage, args[1])
 	default:
-		return false
+		return false, nil
+	}
+}
+
+// findMigrateCommand returns the migrate command with the name, or nil
+func findMigrateCommand(name string) *migrateCommand {
+	for i := range migrateCommands {
+		if migrateCommands[i].name == name {
+			return &migrateCommands[i]
+		}
 	}
+	return nil
+}
+
+// execute parses the flags and arguments of the command and runs it
+func (c migrateCommand) execute(env commandEnv, args []string) error {
+	flags, opts := c.flagSet()
+	flags.SetOutput(os.Stderr)
+
+	// Allow flags before, between and after positional arguments
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return fmt.Errorf("%w: %v", ErrUsage, err)
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) != len(c.args) {
+		flags.Usage()
+		return fmt.Errorf("%w: migrate %s expects %d arguments, got %d",
+			ErrUsage, c.name, len(c.args), len(positional))
+	}
+	if opts.format != "text" && opts.format != "json" {
+		flags.Usage()
+		return fmt.Errorf("%w: unknown format %q", ErrUsage, opts.format)
+	}
+	return c.run(env, *opts, positional)
+}
+
+// flagSet returns a flag set with the flags supported by the command
+func (c migrateCommand) flagSet() (*flag.FlagSet, *commandOptions) {
+	opts := &commandOptions{to: -1, format: "text"}
+	flags := flag.NewFlagSet("migrate "+c.name, flag.ContinueOnError)
+	for _, name := range c.flags {
+		switch name {
+		case "dry-run":
+			flags.BoolVar(&opts.dryRun, "dry-run", false, "Show what would run without changing the database.")
+		case "to":
+			flags.IntVar(&opts.to, "to", -1, "Target version.")
+		case "yes":
+			flags.BoolVar(&opts.yes, "yes", false, "Confirm a destructive operation.")
+		case "format":
+			flags.StringVar(&opts.format, "format", "text", "Output format: text or json.")
+		case "phase":
+			flags.Func("phase", "Apply only the sections of a phase: pre or post.", func(value string) error {
+				phase, err := ParsePhase(value)
+				opts.phase = phase
+				return err
+			})
+		}
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s\n\t%s\n", c.usage(), c.description)
+		flags.PrintDefaults()
+	}
+	return flags, opts
+}
+
+// usage formats the command with its arguments and flags
+func (c migrateCommand) usage() string {
+	parts := []string{"migrate", c.name}
+	for _, arg := range c.args {
+		parts = append(parts, "<"+arg+">")
+	}
+	for _, name := range c.flags {
+		switch name {
+		case "to":
+			parts = append(parts, "[--to <version>]")
+		case "format":
+			parts = append(parts, "[--format text|json]")
+		case "phase":
+			parts = append(parts, "[--phase pre|post]")
+		default:
+			parts = append(parts, "[--"+name+"]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseVersionArg parses a version argument
+func parseVersionArg(arg string) (int, error) {
+	version, err := strconv.Atoi(arg)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("%w: invalid version %q", ErrUsage, arg)
+	}
+	return version, nil
+}
+
+// writeOutput writes value as JSON or as text using its String method
+func writeOutput(out io.Writer, format string, value fmt.Stringer) error {
+	if format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	_, err := fmt.Fprint(out, value.String())
+	return err
+}
+
+// historyEntries formats history entries for display on the command line
+type historyEntries []HistoryEntry
+
+func (h historyEntries) String() string {
+	var b strings.Builder
+	for _, entry := range h {
+		outcome := "ok"
+		if !entry.Success {
+			outcome = "failed: " + entry.Error
+		}
+		fmt.Fprintf(&b, "%s  %-8s %04d  %8s  %s  %s\n",
+			entry.StartedAt.Format(time.RFC3339), entry.Operation, entry.Version,
+			entry.Duration, entry.Actor, outcome)
+	}
+	return b.String()
 }
 
 func GetHelpString() string {
-	return `
-	migrate up     - Apply all new database migrations.
-	migrate down   - Rollback a single database migration.`
+	var b strings.Builder
+	for _, command := range migrateCommands {
+		fmt.Fprintf(&b, "\n\t%s\n\t               - %s", command.usage(), command.description)
+	}
+	return b.String()
 }
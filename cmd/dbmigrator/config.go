@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/NotCoffee418/dbmigrator"
+)
+
+// config describes how to connect to the database and where the migrations are.
+// Values are read from a JSON config file, environment variables and flags,
+// with later sources overriding earlier ones.
+type config struct {
+	Driver  string `json:"driver"`
+	DSN     string `json:"dsn"`
+	Dir     string `json:"dir"`
+	Dialect string `json:"dialect"`
+}
+
+// resolveConfig reads the config file at configPath when set and applies the environment variables
+// and flagConfig, the values set with flags. Flags override environment variables which override the config file.
+func resolveConfig(configPath string, flagConfig config) (config, error) {
+	cfg := config{Dir: "migrations"}
+	if configPath != "" {
+		fileConfig, err := loadConfigFile(configPath)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.merge(fileConfig)
+	}
+	cfg.applyEnv()
+	cfg.merge(flagConfig)
+	return cfg, nil
+}
+
+// loadConfigFile reads a JSON config file such as
+// {"driver": "postgres", "dsn": "...", "dir": "migrations", "dialect": "postgres"}
+func loadConfigFile(path string) (config, error) {
+	var cfg config
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("error reading config file: %w", err)
+	}
+	if err := json.Unmarshal(contents, &cfg); err != nil {
+		return cfg, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides values with the DBMIGRATOR_* environment variables that are set
+func (c *config) applyEnv() {
+	for env, value := range map[string]*string{
+		"DBMIGRATOR_DRIVER":  &c.Driver,
+		"DBMIGRATOR_DSN":     &c.DSN,
+		"DBMIGRATOR_DIR":     &c.Dir,
+		"DBMIGRATOR_DIALECT": &c.Dialect,
+	} {
+		if v, ok := os.LookupEnv(env); ok {
+			*value = v
+		}
+	}
+}
+
+// merge overrides values with the non-empty values of other
+func (c *config) merge(other config) {
+	if other.Driver != "" {
+		c.Driver = other.Driver
+	}
+	if other.DSN != "" {
+		c.DSN = other.DSN
+	}
+	if other.Dir != "" {
+		c.Dir = other.Dir
+	}
+	if other.Dialect != "" {
+		c.Dialect = other.Dialect
+	}
+}
+
+// queryDefinition returns the query set for the configured dialect,
+// or nil to detect it from the driver when no dialect is configured.
+func (c *config) queryDefinition() (*dbmigrator.MigrationQueryDefinition, error) {
+	if c.Dialect == "" {
+		return nil, nil
+	}
+	return dbmigrator.Dialect(c.Dialect)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// unsetConfigEnv unsets the DBMIGRATOR_* environment variables for the duration of a test
+func unsetConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, env := range []string{"DBMIGRATOR_CONFIG", "DBMIGRATOR_DRIVER", "DBMIGRATOR_DSN", "DBMIGRATOR_DIR", "DBMIGRATOR_DIALECT"} {
+		t.Setenv(env, "")
+		if err := os.Unsetenv(env); err != nil {
+			t.Fatalf("Failed to unset %s: %s", env, err)
+		}
+	}
+}
+
+func TestResolveConfigPrecedence(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		file     string
+		env      map[string]string
+		flags    config
+		expected config
+	}{
+		{
+			name:     "defaults",
+			expected: config{Dir: "migrations"},
+		},
+		{
+			name:     "file",
+			file:     `{"driver": "postgres", "dsn": "file-dsn", "dir": "file-dir", "dialect": "postgres"}`,
+			expected: config{Driver: "postgres", DSN: "file-dsn", Dir: "file-dir", Dialect: "postgres"},
+		},
+		{
+			name:     "env overrides file",
+			file:     `{"driver": "postgres", "dsn": "file-dsn", "dir": "file-dir"}`,
+			env:      map[string]string{"DBMIGRATOR_DSN": "env-dsn", "DBMIGRATOR_DIALECT": "cockroachdb"},
+			expected: config{Driver: "postgres", DSN: "env-dsn", Dir: "file-dir", Dialect: "cockroachdb"},
+		},
+		{
+			name:     "flags override env and file",
+			file:     `{"driver": "postgres", "dsn": "file-dsn", "dir": "file-dir"}`,
+			env:      map[string]string{"DBMIGRATOR_DSN": "env-dsn", "DBMIGRATOR_DIR": "env-dir"},
+			flags:    config{DSN: "flag-dsn"},
+			expected: config{Driver: "postgres", DSN: "flag-dsn", Dir: "env-dir"},
+		},
+		{
+			name:     "flags without file",
+			env:      map[string]string{"DBMIGRATOR_DRIVER": "mysql"},
+			flags:    config{Driver: "sqlite3", DSN: "flag-dsn", Dir: "flag-dir"},
+			expected: config{Driver: "sqlite3", DSN: "flag-dsn", Dir: "flag-dir"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			unsetConfigEnv(t)
+			for env, value := range test.env {
+				t.Setenv(env, value)
+			}
+			configPath := ""
+			if test.file != "" {
+				configPath = filepath.Join(t.TempDir(), "dbmigrator.json")
+				if err := os.WriteFile(configPath, []byte(test.file), 0o644); err != nil {
+					t.Fatalf("Failed to write config file: %s", err)
+				}
+			}
+
+			cfg, err := resolveConfig(configPath, test.flags)
+			if err != nil {
+				t.Fatalf("resolveConfig failed: %s", err)
+			}
+			if cfg != test.expected {
+				t.Fatalf("Expected %+v, got %+v", test.expected, cfg)
+			}
+		})
+	}
+}
+
+func TestResolveConfigInvalidFile(t *testing.T) {
+	unsetConfigEnv(t)
+	configPath := filepath.Join(t.TempDir(), "dbmigrator.json")
+	if err := os.WriteFile(configPath, []byte(`{"dsn": `), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %s", err)
+	}
+	if _, err := resolveConfig(configPath, config{}); err == nil {
+		t.Fatalf("Expected an invalid config file to fail")
+	}
+	if _, err := resolveConfig(filepath.Join(t.TempDir(), "missing.json"), config{}); err == nil {
+		t.Fatalf("Expected a missing config file to fail")
+	}
+}
@@ -0,0 +1,112 @@
+// Command dbmigrator runs dbmigrator commands against any database
+// with migrations read from a directory on disk.
+//
+// Usage:
+//
+//	dbmigrator [flags] <command>
+//
+// The connection is configured with flags, DBMIGRATOR_* environment variables
+// or a JSON config file. Run `dbmigrator help` for the available commands.
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/NotCoffee418/dbmigrator"
+	log "github.com/sirupsen/logrus"
+
+	_ "github.com/denisenkom/go-mssqldb"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	_ "modernc.org/sqlite"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// run runs the command in args, writing usage and errors to stderr, and returns the exit code
+func run(args []string, stderr io.Writer) int {
+	logger := log.New()
+	logger.SetOutput(stderr)
+	flags := flag.NewFlagSet("dbmigrator", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", os.Getenv("DBMIGRATOR_CONFIG"),
+		"JSON config file with driver, dsn, dir and dialect (env DBMIGRATOR_CONFIG)")
+	var flagConfig config
+	flags.StringVar(&flagConfig.Driver, "driver", "",
+		"database/sql driver: postgres, mysql, sqlite3, sqlite (pure Go) or sqlserver (env DBMIGRATOR_DRIVER)")
+	flags.StringVar(&flagConfig.DSN, "dsn", "", "data source name (env DBMIGRATOR_DSN)")
+	flags.StringVar(&flagConfig.Dir, "dir", "", "migrations directory on disk, defaults to migrations (env DBMIGRATOR_DIR)")
+	flags.StringVar(&flagConfig.Dialect, "dialect", "",
+		"registered dialect such as postgres, mysql, sqlite or sqlserver, detected from the driver by default (env DBMIGRATOR_DIALECT)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dbmigrator [flags] <command>")
+		flags.PrintDefaults()
+		fmt.Fprintln(flags.Output(), "\nCommands:"+dbmigrator.GetHelpString())
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	cfg, err := resolveConfig(*configPath, flagConfig)
+	if err != nil {
+		logger.Error(err)
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) == 0 || args[0] == "help" {
+		flags.Usage()
+		return 0
+	}
+	// Allow `dbmigrator up` as well as `dbmigrator migrate up`
+	if args[0] != "migrate" {
+		args = append([]string{"migrate"}, args...)
+	}
+
+	if cfg.Driver == "" || cfg.DSN == "" {
+		logger.Error("A driver and dsn are required, see dbmigrator help")
+		return 1
+	}
+	queryDef, err := cfg.queryDefinition()
+	if err != nil {
+		logger.Error(err)
+		return 1
+	}
+	dbmigrator.SetDatabaseType(queryDef)
+
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		logger.Errorf("Error opening database: %v", err)
+		return 1
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		logger.Errorf("Error connecting to database: %v", err)
+		return 1
+	}
+
+	handled, err := dbmigrator.HandleMigratorCommandDir(db, cfg.Dir, args...)
+	if !handled {
+		flags.Usage()
+		return 2
+	}
+	if errors.Is(err, dbmigrator.ErrUsage) {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if err != nil {
+		logger.Error(err)
+		return 1
+	}
+	return 0
+}
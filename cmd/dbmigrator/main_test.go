@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	migrationDir := filepath.Join(dir, "migrations")
+	if err := os.MkdirAll(migrationDir, 0o755); err != nil {
+		t.Fatalf("Failed to create migrations directory: %s", err)
+	}
+	dsn := "file:" + filepath.Join(dir, "run.db")
+
+	for _, test := range []struct {
+		name   string
+		env    map[string]string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{
+			name:   "help",
+			args:   []string{"help"},
+			code:   0,
+			stderr: "Usage: dbmigrator",
+		},
+		{
+			name:   "missing dsn",
+			args:   []string{"--driver", "sqlite3", "status"},
+			code:   1,
+			stderr: "A driver and dsn are required",
+		},
+		{
+			name:   "missing dsn with driver from env",
+			env:    map[string]string{"DBMIGRATOR_DRIVER": "sqlite3"},
+			args:   []string{"status"},
+			code:   1,
+			stderr: "A driver and dsn are required",
+		},
+		{
+			name:   "unknown command",
+			args:   []string{"--driver", "sqlite3", "--dsn", dsn, "--dir", migrationDir, "bogus"},
+			code:   2,
+			stderr: `unknown migrate command "bogus"`,
+		},
+		{
+			name:   "unknown flag",
+			args:   []string{"--bogus", "status"},
+			code:   2,
+			stderr: "flag provided but not defined",
+		},
+		{
+			name:   "unknown dialect",
+			args:   []string{"--driver", "sqlite3", "--dsn", dsn, "--dialect", "bogus", "status"},
+			code:   1,
+			stderr: "bogus",
+		},
+		{
+			name: "status",
+			args: []string{"--driver", "sqlite3", "--dsn", dsn, "--dir", migrationDir, "status"},
+			code: 0,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			unsetConfigEnv(t)
+			for env, value := range test.env {
+				t.Setenv(env, value)
+			}
+			var stderr bytes.Buffer
+			code := run(test.args, &stderr)
+			if code != test.code {
+				t.Fatalf("Expected exit code %d, got %d: %s", test.code, code, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), test.stderr) {
+				t.Fatalf("Expected stderr to contain %q, got %s", test.stderr, stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package dbmigrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// versionPollInterval is how often WaitForVersion reads the installed version
+var versionPollInterval = time.Second
+
+// CheckCompatibility returns the installed migration version, failing with ErrIncompatibleVersion
+// when it is lower than minVersion or higher than maxVersion. A maxVersion of 0 has no upper bound.
+// It only reads the database, a database without migrations table has version 0.
+func CheckCompatibility(db *sql.DB, minVersion int, maxVersion int) (int, error) {
+	return CheckCompatibilityWith(SQLExecutor(db), minVersion, maxVersion)
+}
+
+// CheckCompatibilityWith works like CheckCompatibility with queries run by an Executor.
+func CheckCompatibilityWith(db Executor, minVersion int, maxVersion int) (int, error) {
+	bound, err := withQueries(db)
+	if err != nil {
+		return 0, err
+	}
+	version, _, err := readInstalledVersion(bound)
+	if err != nil {
+		return 0, err
+	}
+	if version < minVersion {
+		return version, fmt.Errorf("%w: version %d is lower than the minimum version %d",
+			ErrIncompatibleVersion, version, minVersion)
+	}
+	if maxVersion > 0 && version > maxVersion {
+		return version, fmt.Errorf("%w: version %d is higher than the maximum version %d",
+			ErrIncompatibleVersion, version, maxVersion)
+	}
+	return version, nil
+}
+
+// WaitForVersion polls the installed migration version until it reaches version,
+// for replicas starting while another instance migrates the database.
+// Returns the context error when ctx is done first. Like CheckCompatibility it only reads the database.
+func WaitForVersion(ctx context.Context, db *sql.DB, version int) error {
+	return WaitForVersionWith(ctx, SQLExecutor(db), version)
+}
+
+// WaitForVersionWith works like WaitForVersion with queries run by an Executor.
+func WaitForVersionWith(ctx context.Context, db Executor, version int) error {
+	bound, err := withQueries(db)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(versionPollInterval)
+	defer ticker.Stop()
+	for {
+		installed, _, err := readInstalledVersion(bound)
+		if err != nil {
+			return err
+		}
+		if installed >= version {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for migration version %d, installed version is %d: %w",
+				version, installed, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// readInstalledVersion returns the installed migration version and whether the migrations table exists,
+// without creating the migrations table
+func readInstalledVersion(db *queryExecutor) (int, bool, error) {
+	exists, err := migrationsTableExists(db)
+	if err != nil || !exists {
+		return 0, false, err
+	}
+
+	var version int
+	err = db.QueryRow(db.queries.SelectInstalledVersion).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, true, nil
+		}
+		return 0, true, fmt.Errorf("error getting migration version: %w", err)
+	}
+	return version, true, nil
+}
+
+// migrationsTableExists reports whether the migrations table exists
+func migrationsTableExists(db *queryExecutor) (bool, error) {
+	var exists bool
+	if err := db.QueryRow(db.queries.CheckTableExists).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error checking if migrations table exists: %w", err)
+	}
+	return exists, nil
+}
+
+// bookkeepingTableExists reports whether a bookkeeping table exists.
+// Databases last migrated by an older release lack the tables added since,
+// the table is assumed to exist when the dialect can not check.
+func bookkeepingTableExists(db *queryExecutor, table string) (bool, error) {
+	if db.queries.CheckTableExistsByName == "" {
+		return true, nil
+	}
+	var exists bool
+	if err := db.QueryRow(db.queries.CheckTableExistsByName, table).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error checking if %s table exists: %w", table, err)
+	}
+	return exists, nil
+}
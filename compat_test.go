@@ -0,0 +1,74 @@
+package dbmigrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	db := openSQLiteTestDB(t)
+
+	// A fresh database has version 0 and is left untouched
+	version, err := CheckCompatibility(db, 0, 0)
+	if err != nil || version != 0 {
+		t.Fatalf("Expected version 0, got %d (%v)", version, err)
+	}
+	if tableExists(t, db, "migrations") {
+		t.Fatalf("Expected CheckCompatibility not to create the migrations table")
+	}
+	if _, err := CheckCompatibility(db, 1, 0); !errors.Is(err, ErrIncompatibleVersion) {
+		t.Fatalf("Expected ErrIncompatibleVersion below the minimum version, got %v", err)
+	}
+
+	migrationFs := fstest.MapFS{
+		"migrations/0001_a.sql": {Data: []byte("-- +up\nCREATE TABLE a (id INT);\n")},
+		"migrations/0002_b.sql": {Data: []byte("-- +up\nCREATE TABLE b (id INT);\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+	version, err = CheckCompatibility(db, 1, 2)
+	if err != nil || version != 2 {
+		t.Fatalf("Expected version 2 to be compatible, got %d (%v)", version, err)
+	}
+	version, err = CheckCompatibility(db, 1, 1)
+	if !errors.Is(err, ErrIncompatibleVersion) || version != 2 {
+		t.Fatalf("Expected ErrIncompatibleVersion above the maximum version, got %d (%v)", version, err)
+	}
+}
+
+func TestWaitForVersion(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	defer func(interval time.Duration) { versionPollInterval = interval }(versionPollInterval)
+	versionPollInterval = 10 * time.Millisecond
+
+	// Times out while nothing migrates
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := WaitForVersion(ctx, db, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// Returns once another instance recorded the version
+	migrated := make(chan error, 1)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		if _, err := db.Exec(SQLite.CreateMigrationsTable); err != nil {
+			migrated <- err
+			return
+		}
+		_, err := db.Exec(SQLite.InsertMigration, 1, time.Now())
+		migrated <- err
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := WaitForVersion(ctx, db, 1); err != nil {
+		t.Fatalf("WaitForVersion failed: %s", err)
+	}
+	if err := <-migrated; err != nil {
+		t.Fatalf("Recording version 1 failed: %s", err)
+	}
+}
@@ -0,0 +1,221 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// batchSizeToken is replaced with the batch size in the statement of a batched data migration
+const batchSizeToken = "{batch_size}"
+
+// DataMigrationFunc runs a single batch of a batched data migration in tx.
+// checkpoint is the value returned by the previous batch, empty for the first batch,
+// and is stored with the batch so an interrupted migration resumes from it.
+// The migration is complete once a batch affects zero rows.
+type DataMigrationFunc func(tx Tx, checkpoint string, batchSize int) (next string, affected int64, err error)
+
+// DataMigrationOptions configures batched data migrations.
+type DataMigrationOptions struct {
+	BatchSize int           // Rows per batch, `-- +batch size=N` overrides it per file. Defaults to 1000.
+	Pause     time.Duration // Pause between batches, `-- +batch pause=D` overrides it per file
+	Progress  func(progress DataMigrationProgress)
+}
+
+// DataMigrationProgress is reported after each batch of a batched data migration.
+type DataMigrationProgress struct {
+	Version      int
+	Batches      int   // Batches run, including those of interrupted runs
+	RowsAffected int64 // Rows affected by all batches
+	Checkpoint   string
+	Done         bool // The last batch affected zero rows
+}
+
+// batchDirective is the `-- +batch` header directive of a batched data migration
+type batchDirective struct {
+	funcName  string // registered DataMigrationFunc, empty to run the up section as the batch statement
+	batchSize int    // 0 to use the configured batch size
+	pause     *time.Duration
+}
+
+var (
+	dataMigrationsMu sync.RWMutex
+	dataMigrations   = map[string]DataMigrationFunc{}
+)
+
+// RegisterDataMigration registers a Go function run by migrations with a `-- +batch func=name` directive.
+func RegisterDataMigration(name string, fn DataMigrationFunc) {
+	dataMigrationsMu.Lock()
+	defer dataMigrationsMu.Unlock()
+	dataMigrations[name] = fn
+}
+
+// parseBatchDirective parses the arguments of a `-- +batch` directive, such as `func=backfill size=500 pause=1s`
+func parseBatchDirective(arguments string) (*batchDirective, error) {
+	directive := &batchDirective{}
+	for _, argument := range strings.Fields(arguments) {
+		key, value, found := strings.Cut(argument, "=")
+		if !found {
+			return nil, fmt.Errorf("expected key=value, got %q", argument)
+		}
+		switch key {
+		case "func":
+			directive.funcName = value
+		case "size":
+			size, err := strconv.Atoi(value)
+			if err != nil || size <= 0 {
+				return nil, fmt.Errorf("invalid batch size %q", value)
+			}
+			directive.batchSize = size
+		case "pause":
+			pause, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pause %q: %w", value, err)
+			}
+			directive.pause = &pause
+		default:
+			return nil, fmt.Errorf("unknown argument %q", key)
+		}
+	}
+	return directive, nil
+}
+
+// applyDataMigration runs the batches of a batched data migration in separate transactions,
+// resuming from the stored checkpoint, and records it once a batch affects zero rows
+func applyDataMigration(db *queryExecutor, migration *migrationFileInfo) error {
+	if db.queries.CreateCheckpointsTable == "" {
+		return fmt.Errorf("migration %d is a batched data migration, which the dialect does not support", migration.version)
+	}
+	directive := migration.contents.batch
+	runBatch, err := batchRunner(migration)
+	if err != nil {
+		return err
+	}
+	batchSize := activeDataMigrationOptions.BatchSize
+	if directive.batchSize > 0 {
+		batchSize = directive.batchSize
+	}
+	pause := activeDataMigrationOptions.Pause
+	if directive.pause != nil {
+		pause = *directive.pause
+	}
+
+	// Resume from the checkpoint of an interrupted run
+	progress := DataMigrationProgress{Version: migration.version}
+	err = db.QueryRow(db.queries.SelectCheckpoint, migration.version).
+		Scan(&progress.Checkpoint, &progress.Batches, &progress.RowsAffected)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error reading checkpoint of migration %d: %w", migration.version, err)
+	}
+	if progress.Batches > 0 {
+		log.Printf("Resuming migration %d after batch %d (%d rows)\n",
+			migration.version, progress.Batches, progress.RowsAffected)
+	}
+
+	for !progress.Done {
+		tx, err := beginMigrationTx(db, migration.contents)
+		if err != nil {
+			return err
+		}
+		next, affected, err := runBatch(tx, progress.Checkpoint, batchSize)
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error running batch %d of migration %d: %w", progress.Batches+1, migration.version, err)
+		}
+		progress.Batches++
+		progress.RowsAffected += affected
+		progress.Checkpoint = next
+		progress.Done = affected == 0
+
+		// Store the checkpoint with the batch
+		if _, err := tx.Exec(db.queries.DeleteCheckpoint, migration.version); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error removing checkpoint of migration %d: %w", migration.version, err)
+		}
+		_, err = tx.Exec(db.queries.InsertCheckpoint, migration.version,
+			progress.Checkpoint, progress.Batches, progress.RowsAffected, time.Now())
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error storing checkpoint of migration %d: %w", migration.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing batch %d of migration %d: %w", progress.Batches, migration.version, err)
+		}
+
+		reportDataMigrationProgress(progress)
+		if !progress.Done && pause > 0 {
+			time.Sleep(pause)
+		}
+	}
+
+	// Record the migration and remove its checkpoint
+	tx, err := db.Begin(nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	if _, err := tx.Exec(db.queries.InsertMigration, migration.version, time.Now()); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error inserting migration version into migrations table %d: %w", migration.version, err)
+	}
+	if err := insertMigrationScript(db.queries, tx, migration); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(db.queries.DeleteCheckpoint, migration.version); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error removing checkpoint of migration %d: %w", migration.version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing migration %d: %w", migration.version, err)
+	}
+	return nil
+}
+
+// batchRunner returns the function running a single batch of a batched data migration,
+// the registered Go function or the up section as the batch statement
+func batchRunner(migration *migrationFileInfo) (DataMigrationFunc, error) {
+	if name := migration.contents.batch.funcName; name != "" {
+		dataMigrationsMu.RLock()
+		defer dataMigrationsMu.RUnlock()
+		fn, ok := dataMigrations[name]
+		if !ok {
+			return nil, fmt.Errorf("data migration %q of migration %d is not registered, "+
+				"call dbmigrator.RegisterDataMigration first", name, migration.version)
+		}
+		return fn, nil
+	}
+
+	statement := strings.TrimSpace(migration.contents.up)
+	if statement == "" {
+		return nil, fmt.Errorf("batched data migration %d has no statement", migration.version)
+	}
+	return func(tx Tx, checkpoint string, batchSize int) (string, int64, error) {
+		result, err := tx.Exec(strings.ReplaceAll(statement, batchSizeToken, strconv.Itoa(batchSize)))
+		if err != nil {
+			return "", 0, err
+		}
+		affected, err := result.RowsAffected()
+		return "", affected, err
+	}, nil
+}
+
+// reportDataMigrationProgress logs the progress of a batched data migration
+// and passes it to the configured progress function
+func reportDataMigrationProgress(progress DataMigrationProgress) {
+	if progress.Done {
+		log.Printf("Migration %d completed after %d batches (%d rows)\n",
+			progress.Version, progress.Batches, progress.RowsAffected)
+	} else {
+		log.Printf("Migration %d batch %d done (%d rows so far)\n",
+			progress.Version, progress.Batches, progress.RowsAffected)
+	}
+	if activeDataMigrationOptions.Progress != nil {
+		activeDataMigrationOptions.Progress(progress)
+	}
+}
@@ -0,0 +1,127 @@
+package dbmigrator
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// seedItems creates an items table with count rows and an empty copy column
+func seedItems(t *testing.T, executor Executor, count int) {
+	t.Helper()
+	if _, err := executor.Exec("CREATE TABLE items (id INT PRIMARY KEY, copy INT NULL)"); err != nil {
+		t.Fatalf("Failed to create items: %s", err)
+	}
+	for i := 1; i <= count; i++ {
+		if _, err := executor.Exec("INSERT INTO items (id) VALUES (?)", i); err != nil {
+			t.Fatalf("Failed to insert item: %s", err)
+		}
+	}
+}
+
+func TestBatchedStatementMigration(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	seedItems(t, SQLExecutor(db), 25)
+	var reported []DataMigrationProgress
+	SetDataMigrationOptions(DataMigrationOptions{Progress: func(progress DataMigrationProgress) {
+		reported = append(reported, progress)
+	}})
+	defer SetDataMigrationOptions(DataMigrationOptions{})
+
+	migrationFs := fstest.MapFS{
+		"migrations/0001_backfill.sql": {Data: []byte("-- +batch size=10\n-- +up\n" +
+			"UPDATE items SET copy = id WHERE id IN (SELECT id FROM items WHERE copy IS NULL LIMIT {batch_size});\n" +
+			"-- +down\nUPDATE items SET copy = NULL;\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+
+	// Batches of 10, 10 and 5 rows followed by an empty batch
+	if len(reported) != 4 || reported[2].RowsAffected != 25 || !reported[3].Done {
+		t.Fatalf("Unexpected progress %+v", reported)
+	}
+	var remaining, checkpoints int
+	if err := db.QueryRow("SELECT COUNT(*) FROM items WHERE copy IS NULL").Scan(&remaining); err != nil || remaining != 0 {
+		t.Fatalf("Expected every item to be backfilled, %d remaining (%v)", remaining, err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM migration_checkpoints").Scan(&checkpoints); err != nil || checkpoints != 0 {
+		t.Fatalf("Expected the checkpoint to be removed, got %d (%v)", checkpoints, err)
+	}
+	version, err := getInstalledMigrationVersion(bindTestQueries(t, SQLExecutor(db)))
+	if err != nil || version != 1 {
+		t.Fatalf("Expected version 1, got %d (%v)", version, err)
+	}
+}
+
+func TestBatchedFuncMigrationResumes(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	seedItems(t, SQLExecutor(db), 10)
+	var checkpoints []string
+	failAfter := "6"
+	RegisterDataMigration("copy_items", func(tx Tx, checkpoint string, batchSize int) (string, int64, error) {
+		checkpoints = append(checkpoints, checkpoint)
+		if checkpoint == failAfter {
+			return "", 0, errors.New("interrupted")
+		}
+		after, _ := strconv.Atoi(checkpoint)
+		result, err := tx.Exec("UPDATE items SET copy = id WHERE id > ? AND id <= ?", after, after+batchSize)
+		if err != nil {
+			return "", 0, err
+		}
+		affected, _ := result.RowsAffected()
+		return strconv.Itoa(after + batchSize), affected, nil
+	})
+	migrationFs := fstest.MapFS{
+		"migrations/0001_backfill.sql": {Data: []byte("-- +batch func=copy_items size=3\n-- +up\n")},
+	}
+
+	// The interrupted run keeps the checkpoint of its last batch
+	err := MigrateUp(db, migrationFs, "migrations")
+	if err == nil || !strings.Contains(err.Error(), "batch 3 of migration 1") {
+		t.Fatalf("Expected batch 3 to fail, got %v", err)
+	}
+	var checkpoint string
+	var batches int
+	err = db.QueryRow("SELECT checkpoint, batches FROM migration_checkpoints WHERE version = 1").Scan(&checkpoint, &batches)
+	if err != nil || checkpoint != "6" || batches != 2 {
+		t.Fatalf("Expected the checkpoint after batch 2, got %q, %d (%v)", checkpoint, batches, err)
+	}
+
+	// The next run resumes from the checkpoint
+	failAfter = ""
+	checkpoints = nil
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+	if strings.Join(checkpoints, ",") != "6,9,12" {
+		t.Fatalf("Expected to resume from checkpoint 6, got %v", checkpoints)
+	}
+	var remaining int
+	if err := db.QueryRow("SELECT COUNT(*) FROM items WHERE copy IS NULL").Scan(&remaining); err != nil || remaining != 0 {
+		t.Fatalf("Expected every item to be backfilled, %d remaining (%v)", remaining, err)
+	}
+}
+
+func TestBatchDirective(t *testing.T) {
+	directive, err := parseBatchDirective(" func=backfill size=500 pause=1s")
+	if err != nil || directive.funcName != "backfill" || directive.batchSize != 500 || directive.pause == nil {
+		t.Fatalf("Unexpected directive %+v (%v)", directive, err)
+	}
+	for _, arguments := range []string{"size=0", "pause=soon", "limit=5", "backfill"} {
+		if _, err := parseBatchDirective(arguments); err == nil {
+			t.Fatalf("Expected %q to be invalid", arguments)
+		}
+	}
+
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_backfill.sql": {Data: []byte("-- +batch func=missing\n-- +up\n")},
+	}
+	err = MigrateUp(db, migrationFs, "migrations")
+	if err == nil || !strings.Contains(err.Error(), "RegisterDataMigration") {
+		t.Fatalf("Expected an unregistered data migration to fail, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]*MigrationQueryDefinition{}
+
+	// detectedQueryDefs caches the detected query set per *sql.DB
+	detectedQueryDefs sync.Map
+)
+
+// driverDialects maps the package path prefix of database/sql drivers to the dialect they speak
+var driverDialects = []struct {
+	pkgPrefix string
+	dialect   string
+}{
+	{"github.com/lib/pq", "postgres"},
+	{"github.com/jackc/pgx", "postgres"},
+	{"github.com/go-sql-driver/mysql", "mysql"},
+	{"github.com/mattn/go-sqlite3", "sqlite"},
+	{"modernc.org/sqlite", "sqlite"},
+	{"github.com/denisenkom/go-mssqldb", "sqlserver"},
+	{"github.com/microsoft/go-mssqldb", "sqlserver"},
+	{"github.com/duckdb/duckdb-go", "duckdb"},
+	{"github.com/marcboeker/go-duckdb", "duckdb"},
+}
+
+// serverDialects distinguish databases sharing a driver with another dialect
+// by the version string the server reports
+var serverDialects = []struct {
+	driverDialect string
+	versionQuery  string
+	contains      string
+	dialect       string
+}{
+	{"postgres", "SELECT version()", "CockroachDB", "cockroachdb"},
+	{"mysql", "SELECT VERSION()", "MariaDB", "mariadb"},
+}
+
+func init() {
+	RegisterDialect("postgres", PostgreSQL)
+	RegisterDialect("postgresql", PostgreSQL)
+	RegisterDialect("pgx", PostgreSQL)
+	RegisterDialect("mysql", MySQL)
+	RegisterDialect("sqlite", SQLite)
+	RegisterDialect("sqlite3", SQLite)
+	RegisterDialect("sqlserver", SQLServer)
+	RegisterDialect("mssql", SQLServer)
+	RegisterDialect("duckdb", DuckDB)
+	RegisterDialect("cockroachdb", CockroachDB)
+	RegisterDialect("cockroach", CockroachDB)
+	RegisterDialect("mariadb", MariaDB)
+}
+
+// RegisterDialect registers a query set under a name for use with Dialect,
+// replacing any query set registered under the same name. Names are case insensitive.
+func RegisterDialect(name string, def *MigrationQueryDefinition) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[strings.ToLower(name)] = def
+}
+
+// Dialect returns the query set registered under a name, such as "postgres".
+func Dialect(name string) (*MigrationQueryDefinition, error) {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	def, ok := dialects[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown dialect %q, registered dialects are %s",
+			name, strings.Join(dialectNames(), ", "))
+	}
+	return def, nil
+}
+
+// DetectDialect returns the query set for the database/sql driver used by db.
+// CockroachDB and MariaDB are told apart from PostgreSQL and MySQL by their server version.
+func DetectDialect(db *sql.DB) (*MigrationQueryDefinition, error) {
+	return detectDialect(SQLExecutor(db))
+}
+
+// detectDialect returns the query set for the driver of an executor
+func detectDialect(db Executor) (*MigrationQueryDefinition, error) {
+	driverName := db.DriverName()
+	if driverName == "" {
+		return nil, fmt.Errorf("can not detect the dialect of a transaction, call dbmigrator.SetDatabaseType first")
+	}
+	for _, driverDialect := range driverDialects {
+		if strings.HasPrefix(driverName, driverDialect.pkgPrefix) {
+			return Dialect(detectServerDialect(db, driverDialect.dialect))
+		}
+	}
+	return nil, fmt.Errorf(
+		"can not detect the dialect of database driver %q, call dbmigrator.SetDatabaseType first",
+		driverName)
+}
+
+// detectServerDialect returns the dialect of the server behind a driver of driverDialect
+func detectServerDialect(db Executor, driverDialect string) string {
+	for _, serverDialect := range serverDialects {
+		if serverDialect.driverDialect != driverDialect {
+			continue
+		}
+		var version string
+		if err := db.QueryRow(serverDialect.versionQuery).Scan(&version); err != nil {
+			log.Warnf("Error reading server version to detect the dialect, using %s: %v", driverDialect, err)
+			return driverDialect
+		}
+		if strings.Contains(version, serverDialect.contains) {
+			return serverDialect.dialect
+		}
+	}
+	return driverDialect
+}
+
+// queryExecutor is an Executor with the query set resolved for it.
+// Each operation resolves its own, so concurrent operations such as health checks
+// during a migration, or on databases of different dialects, do not share state.
+type queryExecutor struct {
+	Executor
+	queries *MigrationQueryDefinition
+}
+
+// withQueries binds db to the query set to use with it:
+// the one set with SetDatabaseType, or the one detected from the driver of db.
+func withQueries(db Executor) (*queryExecutor, error) {
+	if bound, ok := db.(*queryExecutor); ok {
+		return bound, nil
+	}
+	queries, err := resolveQueries(db)
+	if err != nil {
+		return nil, err
+	}
+	return &queryExecutor{Executor: db, queries: queries}, nil
+}
+
+// resolveQueries returns the query set set with SetDatabaseType, or the one detected from the driver of db
+func resolveQueries(db Executor) (*MigrationQueryDefinition, error) {
+	if configured := configuredQueryDef; configured != nil {
+		return configured, nil
+	}
+	if def, ok := detectedQueryDefs.Load(db); ok {
+		return def.(*MigrationQueryDefinition), nil
+	}
+	def, err := detectDialect(db)
+	if err != nil {
+		return nil, err
+	}
+	detectedQueryDefs.Store(db, def)
+	return def, nil
+}
+
+// Begin starts a transaction, or a savepoint of the resolved query set in a caller's transaction
+func (db *queryExecutor) Begin(opts *sql.TxOptions) (Tx, error) {
+	if tx, ok := db.Executor.(*txExecutor); ok {
+		return tx.begin(db.queries)
+	}
+	return db.Executor.Begin(opts)
+}
+
+// dialectNames returns the sorted names of the registered dialects
+func dialectNames() []string {
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,69 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// unknownDriver is a database/sql driver no dialect is registered for
+type unknownDriver struct{}
+
+func (unknownDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("not implemented")
+}
+
+func init() {
+	sql.Register("dbmigrator-unknown", unknownDriver{})
+}
+
+func TestDialectRegistry(t *testing.T) {
+	def, err := Dialect("PostgreSQL")
+	if err != nil || def != PostgreSQL {
+		t.Fatalf("Expected the PostgreSQL query set, got %v, %v", def, err)
+	}
+	if _, err := Dialect("oracle"); err == nil {
+		t.Fatalf("Expected an error for an unregistered dialect")
+	}
+
+	custom := &MigrationQueryDefinition{}
+	RegisterDialect("custom", custom)
+	if def, err := Dialect("custom"); err != nil || def != custom {
+		t.Fatalf("Expected the registered query set, got %v, %v", def, err)
+	}
+}
+
+func TestDetectDialect(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	SetDatabaseType(nil)
+
+	def, err := DetectDialect(db)
+	if err != nil || def != SQLite {
+		t.Fatalf("Expected SQLite to be detected, got %v, %v", def, err)
+	}
+
+	// Migrations run without SetDatabaseType
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+	if !tableExists(t, db, "one") {
+		t.Fatalf("Expected migration to be applied")
+	}
+
+	// Unknown drivers fail clearly instead of using the wrong query set
+	unknown, err := sql.Open("dbmigrator-unknown", "")
+	if err != nil {
+		t.Fatalf("Failed to open database: %s", err)
+	}
+	defer unknown.Close()
+	err = MigrateUp(unknown, migrationFs, "migrations")
+	if err == nil || !strings.Contains(err.Error(), "SetDatabaseType") {
+		t.Fatalf("Expected a detection error, got %v", err)
+	}
+}
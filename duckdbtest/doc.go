@@ -0,0 +1,4 @@
+// Package duckdbtest runs the migrator against an in-process DuckDB database.
+// It is a separate module so the cgo DuckDB driver is not a dependency of dbmigrator,
+// run its tests with `go test ./...` from this directory.
+package duckdbtest
@@ -0,0 +1,113 @@
+package duckdbtest
+
+import (
+	"database/sql"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/NotCoffee418/dbmigrator"
+	_ "github.com/duckdb/duckdb-go/v2"
+)
+
+// openDuckDB opens a fresh in-memory DuckDB database with a single connection
+func openDuckDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatalf("Failed to open duckdb database: %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = db.Close()
+		dbmigrator.SetDatabaseType(nil)
+	})
+	return db
+}
+
+func TestMigrationsOnDuckDB(t *testing.T) {
+	db := openDuckDB(t)
+	dbmigrator.SetDatabaseType(nil)
+
+	// The dialect is detected from the driver
+	detected, err := dbmigrator.DetectDialect(db)
+	if err != nil || detected != dbmigrator.DuckDB {
+		t.Fatalf("Expected the DuckDB query set to be detected, got %v", err)
+	}
+
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_two.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE two (id INT);\n-- +down\nDROP TABLE two;\n")},
+		"migrations/R_view.sql": {Data: []byte(
+			"-- +up\nDROP VIEW IF EXISTS one_view;\nCREATE VIEW one_view AS SELECT id FROM one;\n")},
+	}
+	if err := dbmigrator.MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+	if err := dbmigrator.MigrateDown(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateDown failed: %s", err)
+	}
+
+	// Changed repeatable migrations are reapplied
+	migrationFs["migrations/R_view.sql"] = &fstest.MapFile{Data: []byte(
+		"-- +up\nDROP VIEW IF EXISTS one_view;\nCREATE VIEW one_view AS SELECT id, id AS copy FROM one;\n")}
+	if err := dbmigrator.MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+
+	// Timestamps round trip through the history table
+	entries, err := dbmigrator.History(db)
+	if err != nil {
+		t.Fatalf("History failed: %s", err)
+	}
+	if len(entries) < 4 || entries[0].StartedAt.IsZero() || time.Since(entries[0].StartedAt) > time.Hour {
+		t.Fatalf("Unexpected history entries: %+v", entries)
+	}
+
+	result, err := dbmigrator.Verify(db, migrationFs, "migrations")
+	if err != nil || !result.Valid() {
+		t.Fatalf("Expected applied migrations to verify, got %+v, %v", result, err)
+	}
+	health, err := dbmigrator.Health(db, migrationFs, "migrations")
+	if err != nil || !health.Ready || health.LastAppliedAt == nil {
+		t.Fatalf("Expected a ready database, got %+v, %v", health, err)
+	}
+
+	if err := dbmigrator.Fresh(db, migrationFs, "migrations", true); err != nil {
+		t.Fatalf("Fresh failed: %s", err)
+	}
+	status, err := dbmigrator.Status(db, migrationFs, "migrations")
+	if err != nil || status.InstalledVersion != 2 {
+		t.Fatalf("Expected version 2 after fresh, got %+v, %v", status, err)
+	}
+}
+
+func TestPhasesOnDuckDB(t *testing.T) {
+	db := openDuckDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT, old_name VARCHAR);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_rename.sql": {Data: []byte(
+			"-- +up pre\nALTER TABLE one ADD COLUMN new_name VARCHAR;\n" +
+				"-- +up post\nALTER TABLE one DROP COLUMN old_name;\n" +
+				"-- +down\nALTER TABLE one DROP COLUMN new_name;\n")},
+	}
+
+	if err := dbmigrator.MigrateUpPhase(db, migrationFs, "migrations", dbmigrator.PhasePre); err != nil {
+		t.Fatalf("MigrateUpPhase pre failed: %s", err)
+	}
+	status, err := dbmigrator.Status(db, migrationFs, "migrations")
+	if err != nil || status.InstalledVersion != 1 || len(status.PrePhaseVersions) != 1 {
+		t.Fatalf("Expected migration 2 to await its post phase, got %+v, %v", status, err)
+	}
+
+	if err := dbmigrator.MigrateUpPhase(db, migrationFs, "migrations", dbmigrator.PhasePost); err != nil {
+		t.Fatalf("MigrateUpPhase post failed: %s", err)
+	}
+	status, err = dbmigrator.Status(db, migrationFs, "migrations")
+	if err != nil || status.InstalledVersion != 2 || len(status.PrePhaseVersions) != 0 {
+		t.Fatalf("Expected version 2 after the post phase, got %+v, %v", status, err)
+	}
+}
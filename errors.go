@@ -0,0 +1,27 @@
+package dbmigrator
+
+import "errors"
+
+// ErrIrreversible is returned when reverting a migration that has no `-- +down` section
+// or is explicitly marked with `-- +irreversible`.
+var ErrIrreversible = errors.New("migration is irreversible")
+
+// ErrOutOfOrder is returned when migrations with a version lower than the installed version
+// have not been applied, and out of order migrations are not allowed.
+var ErrOutOfOrder = errors.New("unapplied migrations are lower than the installed version")
+
+// ErrAtomicBatchUnsupported is returned when migrating up with SetAtomicBatch enabled
+// on a dialect whose schema changes do not roll back with a transaction.
+var ErrAtomicBatchUnsupported = errors.New("atomic batch requires a dialect with transactional DDL")
+
+// ErrConfirmationRequired is returned by destructive operations such as Reset and Fresh
+// when they are not explicitly confirmed.
+var ErrConfirmationRequired = errors.New("confirmation required")
+
+// ErrUsage is returned by HandleMigratorCommand when a command is invoked
+// with invalid arguments or flags. The usage of the command has been printed.
+var ErrUsage = errors.New("invalid usage")
+
+// ErrIncompatibleVersion is returned by CheckCompatibility when the installed version
+// is outside the range of versions supported by the application
+var ErrIncompatibleVersion = errors.New("installed migration version is not compatible")
@@ -0,0 +1,266 @@
+package dbmigrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// Executor runs the queries of the migrator.
+// SQLExecutor and SQLConnExecutor adapt database/sql,
+// the pgxexecutor package adapts pgx connections and pools.
+type Executor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (Rows, error)
+	QueryRow(query string, args ...any) Row
+	Begin(opts *sql.TxOptions) (Tx, error) // opts may be nil for the driver defaults
+
+	// Session returns an executor bound to a single connection until release is called,
+	// for session state such as advisory locks.
+	Session() (session Executor, release func() error, err error)
+
+	// DriverName identifies the driver for dialect detection,
+	// the package path of a database/sql driver such as github.com/lib/pq.
+	DriverName() string
+}
+
+// Tx is a transaction started by an Executor.
+type Tx interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (Rows, error)
+	QueryRow(query string, args ...any) Row
+	Commit() error
+	Rollback() error
+}
+
+// Batcher is implemented by transactions that send several statements in one round trip,
+// such as pgx batches. Migration scripts are split into statements and sent as one batch.
+type Batcher interface {
+	ExecBatch(statements []string) error
+}
+
+// Rows is the result of a query, *sql.Rows implements it.
+type Rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+	Close() error
+}
+
+// Row is the result of a query returning a single row, *sql.Row implements it.
+type Row interface {
+	Scan(dest ...any) error
+}
+
+// SQLExecutor adapts a database/sql connection pool.
+func SQLExecutor(db *sql.DB) Executor {
+	return sqlDBExecutor{db}
+}
+
+// SQLConnExecutor adapts a single database/sql connection.
+// Migrations and bookkeeping run on conn, which stays open after migrating.
+func SQLConnExecutor(conn *sql.Conn) Executor {
+	return sqlConnExecutor{conn}
+}
+
+// SQLTxExecutor runs all migrations and bookkeeping in a caller's transaction,
+// which the caller commits or rolls back afterwards.
+// The dialect can not be detected from a transaction, call SetDatabaseType first.
+func SQLTxExecutor(tx *sql.Tx) Executor {
+	return TxExecutor(sqlTx{tx}, "")
+}
+
+// TxExecutor runs all migrations and bookkeeping in a caller's transaction of any adapter.
+// Each migration runs in a savepoint when the dialect supports savepoints,
+// so a failed migration is rolled back without aborting tx.
+// driverName is used to detect the dialect and may be empty.
+func TxExecutor(tx Tx, driverName string) Executor {
+	return &txExecutor{tx: tx, driverName: driverName}
+}
+
+type sqlDBExecutor struct {
+	db *sql.DB
+}
+
+func (e sqlDBExecutor) Exec(query string, args ...any) (sql.Result, error) {
+	return e.db.Exec(query, args...)
+}
+
+func (e sqlDBExecutor) Query(query string, args ...any) (Rows, error) {
+	return e.db.Query(query, args...)
+}
+
+func (e sqlDBExecutor) QueryRow(query string, args ...any) Row {
+	return e.db.QueryRow(query, args...)
+}
+
+func (e sqlDBExecutor) Begin(opts *sql.TxOptions) (Tx, error) {
+	tx, err := e.db.BeginTx(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return sqlTx{tx}, nil
+}
+
+func (e sqlDBExecutor) Session() (Executor, func() error, error) {
+	conn, err := e.db.Conn(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	return sqlConnExecutor{conn}, conn.Close, nil
+}
+
+func (e sqlDBExecutor) DriverName() string {
+	return sqlDriverName(e.db.Driver())
+}
+
+type sqlConnExecutor struct {
+	conn *sql.Conn
+}
+
+func (e sqlConnExecutor) Exec(query string, args ...any) (sql.Result, error) {
+	return e.conn.ExecContext(context.Background(), query, args...)
+}
+
+func (e sqlConnExecutor) Query(query string, args ...any) (Rows, error) {
+	return e.conn.QueryContext(context.Background(), query, args...)
+}
+
+func (e sqlConnExecutor) QueryRow(query string, args ...any) Row {
+	return e.conn.QueryRowContext(context.Background(), query, args...)
+}
+
+func (e sqlConnExecutor) Begin(opts *sql.TxOptions) (Tx, error) {
+	tx, err := e.conn.BeginTx(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return sqlTx{tx}, nil
+}
+
+func (e sqlConnExecutor) Session() (Executor, func() error, error) {
+	return e, func() error { return nil }, nil
+}
+
+func (e sqlConnExecutor) DriverName() string {
+	var name string
+	err := e.conn.Raw(func(driverConn any) error {
+		name = packagePath(reflect.TypeOf(driverConn))
+		return nil
+	})
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+type txExecutor struct {
+	tx         Tx
+	driverName string
+	savepoints int
+}
+
+func (e *txExecutor) Exec(query string, args ...any) (sql.Result, error) {
+	return e.tx.Exec(query, args...)
+}
+
+func (e *txExecutor) Query(query string, args ...any) (Rows, error) {
+	return e.tx.Query(query, args...)
+}
+
+func (e *txExecutor) QueryRow(query string, args ...any) Row {
+	return e.tx.QueryRow(query, args...)
+}
+
+// Begin starts a savepoint in the caller's transaction.
+// Without savepoints the work runs directly in the caller's transaction.
+// opts is ignored, the caller's transaction decides the isolation level.
+func (e *txExecutor) Begin(_ *sql.TxOptions) (Tx, error) {
+	queries, err := resolveQueries(e)
+	if err != nil {
+		return nil, err
+	}
+	return e.begin(queries)
+}
+
+// begin starts a savepoint using the savepoint queries of a query set
+func (e *txExecutor) begin(queries *MigrationQueryDefinition) (Tx, error) {
+	savepoint := &savepointTx{Tx: e.tx, queries: queries}
+	if queries.CreateSavepoint != "" {
+		e.savepoints++
+		savepoint.name = fmt.Sprintf("dbmigrator_%d", e.savepoints)
+		if _, err := e.tx.Exec(fmt.Sprintf(queries.CreateSavepoint, savepoint.name)); err != nil {
+			return nil, fmt.Errorf("error creating savepoint: %w", err)
+		}
+	}
+	if _, ok := e.tx.(Batcher); ok {
+		return batchSavepointTx{savepoint}, nil
+	}
+	return savepoint, nil
+}
+
+func (e *txExecutor) Session() (Executor, func() error, error) {
+	return e, func() error { return nil }, nil
+}
+
+func (e *txExecutor) DriverName() string {
+	return e.driverName
+}
+
+// savepointTx is a savepoint in a caller's transaction, or the transaction itself without a name
+type savepointTx struct {
+	Tx
+	name    string
+	queries *MigrationQueryDefinition
+}
+
+func (t *savepointTx) Commit() error {
+	if t.name == "" || t.queries.ReleaseSavepoint == "" {
+		return nil
+	}
+	_, err := t.Tx.Exec(fmt.Sprintf(t.queries.ReleaseSavepoint, t.name))
+	return err
+}
+
+func (t *savepointTx) Rollback() error {
+	if t.name == "" {
+		return nil
+	}
+	_, err := t.Tx.Exec(fmt.Sprintf(t.queries.RollbackToSavepoint, t.name))
+	return err
+}
+
+// batchSavepointTx is a savepoint in a caller's transaction that supports batching
+type batchSavepointTx struct {
+	*savepointTx
+}
+
+func (t batchSavepointTx) ExecBatch(statements []string) error {
+	return t.savepointTx.Tx.(Batcher).ExecBatch(statements)
+}
+
+type sqlTx struct {
+	*sql.Tx
+}
+
+func (t sqlTx) Query(query string, args ...any) (Rows, error) {
+	return t.Tx.Query(query, args...)
+}
+
+func (t sqlTx) QueryRow(query string, args ...any) Row {
+	return t.Tx.QueryRow(query, args...)
+}
+
+// sqlDriverName returns the package path of a database/sql driver
+func sqlDriverName(driver any) string {
+	return packagePath(reflect.TypeOf(driver))
+}
+
+// packagePath returns the package path of a possibly pointer type
+func packagePath(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.PkgPath()
+}
@@ -0,0 +1,123 @@
+package dbmigrator
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"testing/fstest"
+)
+
+// batchTx records the batches sent through the Batcher interface
+type batchTx struct {
+	Tx
+	batches [][]string
+}
+
+func (t *batchTx) ExecBatch(statements []string) error {
+	t.batches = append(t.batches, statements)
+	for _, statement := range statements {
+		if _, err := t.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchExecutor begins transactions that support batching
+type batchExecutor struct {
+	Executor
+	tx *batchTx
+}
+
+func (e *batchExecutor) Begin(opts *sql.TxOptions) (Tx, error) {
+	tx, err := e.Executor.Begin(opts)
+	if err != nil {
+		return nil, err
+	}
+	e.tx = &batchTx{Tx: tx}
+	return e.tx, nil
+}
+
+func TestConnExecutor(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	SetDatabaseType(nil)
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get connection: %s", err)
+	}
+	defer conn.Close()
+
+	executor := SQLConnExecutor(conn)
+	if executor.DriverName() != "github.com/mattn/go-sqlite3" {
+		t.Fatalf("Unexpected driver name %q", executor.DriverName())
+	}
+
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+	}
+	if err := MigrateUpWith(executor, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUpWith failed: %s", err)
+	}
+	version, err := getInstalledMigrationVersion(bindTestQueries(t, executor))
+	if err != nil || version != 1 {
+		t.Fatalf("Expected version 1, got %d, %v", version, err)
+	}
+	if err := conn.PingContext(context.Background()); err != nil {
+		t.Fatalf("Expected the connection to stay open: %s", err)
+	}
+}
+
+func TestBatchedMigrationScript(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	executor := &batchExecutor{Executor: SQLExecutor(db)}
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\nINSERT INTO one VALUES (1);\n-- +down\nDROP TABLE one;\n")},
+	}
+	if err := MigrateUpWith(executor, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUpWith failed: %s", err)
+	}
+	if len(executor.tx.batches) != 1 || len(executor.tx.batches[0]) != 2 {
+		t.Fatalf("Expected the migration to be sent as one batch of 2 statements, got %v", executor.tx.batches)
+	}
+	if !tableExists(t, db, "one") {
+		t.Fatalf("Expected the batched migration to be applied")
+	}
+}
+
+func TestTxExecutor(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %s", err)
+	}
+	defer tx.Rollback()
+	executor := SQLTxExecutor(tx)
+
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_two.sql": {Data: []byte("-- +up\nCREATE TABLE two (id INT);\nINSERT INTO missing VALUES (1);\n-- +down\nDROP TABLE two;\n")},
+	}
+	if err := MigrateUpWith(executor, migrationFs, "migrations"); err == nil {
+		t.Fatalf("Expected the second migration to fail")
+	}
+
+	// The failed migration is rolled back to its savepoint, the caller's transaction stays usable
+	version, err := getInstalledMigrationVersion(bindTestQueries(t, executor))
+	if err != nil || version != 1 {
+		t.Fatalf("Expected version 1 in the transaction, got %d, %v", version, err)
+	}
+	var tables int
+	err = tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name IN ('one', 'two')").Scan(&tables)
+	if err != nil || tables != 1 {
+		t.Fatalf("Expected only table one in the transaction, got %d, %v", tables, err)
+	}
+
+	// Rolling back the caller's transaction discards the migrations
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %s", err)
+	}
+	if tableExists(t, db, "one") || tableExists(t, db, "migrations") {
+		t.Fatalf("Expected the migrations to be rolled back with the transaction")
+	}
+}
@@ -0,0 +1,156 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+// MigrationHealth summarizes the migration state of a database for health checks.
+// It is served as JSON by HealthHandler and ReadinessHandler, field names are stable.
+type MigrationHealth struct {
+	InstalledVersion  int        `json:"installed_version"`
+	AvailableVersion  int        `json:"available_version"`
+	PendingCount      int        `json:"pending_count"`       // Pending versioned migrations, excluding those awaiting their post phase
+	AwaitingPostPhase int        `json:"awaiting_post_phase"` // Migrations whose pre phase was applied
+	Dirty             bool       `json:"dirty"`               // The latest recorded migration operation failed
+	LastAppliedAt     *time.Time `json:"last_applied_at"`     // When the latest migration was applied, null when none was
+	Ready             bool       `json:"ready"`               // No migrations are pending and the database is not dirty
+}
+
+// Health returns the migration health of the database.
+// It only reads the database, a database without migrations table has every migration pending.
+func Health(db *sql.DB, migrationFs fs.FS, migrationDir string) (MigrationHealth, error) {
+	return HealthWith(SQLExecutor(db), migrationFs, migrationDir)
+}
+
+// HealthWith works like Health with queries run by an Executor.
+func HealthWith(db Executor, migrationFs fs.FS, migrationDir string) (MigrationHealth, error) {
+	bound, err := withQueries(db)
+	if err != nil {
+		return MigrationHealth{}, err
+	}
+	state, err := loadMigrationState(bound, migrationFs, migrationDir, false)
+	if err != nil {
+		return MigrationHealth{}, err
+	}
+
+	health := MigrationHealth{
+		InstalledVersion: state.InstalledVersion,
+		AvailableVersion: state.AvailableVersion,
+	}
+	pending, _ := pendingMigrations(state)
+	for _, migration := range pending {
+		if migration.prePhaseApplied {
+			health.AwaitingPostPhase++
+		} else {
+			health.PendingCount++
+		}
+	}
+
+	// Databases last migrated by an older release may lack the history table
+	tableExists, err := migrationsTableExists(bound)
+	if err != nil {
+		return MigrationHealth{}, err
+	}
+	if tableExists {
+		if health.LastAppliedAt, err = selectLastApplied(bound); err != nil {
+			return MigrationHealth{}, err
+		}
+		historyExists, err := bookkeepingTableExists(bound, "migration_history")
+		if err != nil {
+			return MigrationHealth{}, err
+		}
+		if historyExists {
+			if health.Dirty, err = selectLastHistoryFailed(bound); err != nil {
+				return MigrationHealth{}, err
+			}
+		}
+	}
+	health.Ready = health.PendingCount == 0 && !health.Dirty
+	return health, nil
+}
+
+// HealthHandler returns an http.Handler serving the migration health of the database as JSON.
+// It responds with 500 when the health can not be read.
+func HealthHandler(db *sql.DB, migrationFs fs.FS, migrationDir string) http.Handler {
+	return HealthHandlerWith(SQLExecutor(db), migrationFs, migrationDir)
+}
+
+// HealthHandlerWith works like HealthHandler with queries run by an Executor.
+func HealthHandlerWith(db Executor, migrationFs fs.FS, migrationDir string) http.Handler {
+	return healthHandler(db, migrationFs, migrationDir, false)
+}
+
+// ReadinessHandler returns an http.Handler serving the migration health of the database as JSON
+// like HealthHandler, responding with 503 while migrations are pending, the database is dirty
+// or the health can not be read.
+func ReadinessHandler(db *sql.DB, migrationFs fs.FS, migrationDir string) http.Handler {
+	return ReadinessHandlerWith(SQLExecutor(db), migrationFs, migrationDir)
+}
+
+// ReadinessHandlerWith works like ReadinessHandler with queries run by an Executor.
+func ReadinessHandlerWith(db Executor, migrationFs fs.FS, migrationDir string) http.Handler {
+	return healthHandler(db, migrationFs, migrationDir, true)
+}
+
+// healthHandler serves the migration health, failing with 503 when readiness is set and it is not ready
+func healthHandler(db Executor, migrationFs fs.FS, migrationDir string, readiness bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		health, err := HealthWith(db, migrationFs, migrationDir)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if readiness {
+				status = http.StatusServiceUnavailable
+			}
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if readiness && !health.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(health)
+	})
+}
+
+// selectLastApplied returns when the latest migration was applied, nil when unknown
+func selectLastApplied(db *queryExecutor) (*time.Time, error) {
+	if db.queries.SelectLastApplied == "" {
+		return nil, nil
+	}
+	var appliedAt sql.NullTime
+	err := db.QueryRow(db.queries.SelectLastApplied).Scan(&appliedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting last applied migration: %w", err)
+	}
+	if !appliedAt.Valid {
+		return nil, nil
+	}
+	return &appliedAt.Time, nil
+}
+
+// selectLastHistoryFailed reports whether the latest recorded migration operation failed
+func selectLastHistoryFailed(db *queryExecutor) (bool, error) {
+	if db.queries.SelectLastHistory == "" {
+		return false, nil
+	}
+	var success bool
+	err := db.QueryRow(db.queries.SelectLastHistory).Scan(&success)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error getting migration history: %w", err)
+	}
+	return !success, nil
+}
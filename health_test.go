@@ -0,0 +1,162 @@
+package dbmigrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// serveHealth requests handler and decodes the migration health it serves
+func serveHealth(t *testing.T, handler http.Handler) (int, MigrationHealth) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var health MigrationHealth
+	if err := json.Unmarshal(recorder.Body.Bytes(), &health); err != nil {
+		t.Fatalf("Invalid health JSON: %s\n%s", err, recorder.Body.String())
+	}
+	return recorder.Code, health
+}
+
+func TestHealthHandlers(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_a.sql": {Data: []byte("-- +up\nCREATE TABLE a (id INT);\n")},
+		"migrations/0002_b.sql": {Data: []byte("-- +up\nCREATE TABLE b (id INT);\n")},
+	}
+	healthHandler := HealthHandler(db, migrationFs, "migrations")
+	readinessHandler := ReadinessHandler(db, migrationFs, "migrations")
+
+	// Pending migrations without creating the migrations table
+	code, health := serveHealth(t, readinessHandler)
+	if code != http.StatusServiceUnavailable || health.PendingCount != 2 || health.Ready || health.LastAppliedAt != nil {
+		t.Fatalf("Unexpected readiness %d %+v", code, health)
+	}
+	if code, _ := serveHealth(t, healthHandler); code != http.StatusOK {
+		t.Fatalf("Expected the health handler to respond with 200, got %d", code)
+	}
+	if tableExists(t, db, "migrations") {
+		t.Fatalf("Expected the health handlers not to create the migrations table")
+	}
+
+	// Ready once migrated
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+	code, health = serveHealth(t, readinessHandler)
+	if code != http.StatusOK || !health.Ready || health.InstalledVersion != 2 || health.PendingCount != 0 ||
+		health.Dirty || health.LastAppliedAt == nil {
+		t.Fatalf("Unexpected readiness %d %+v", code, health)
+	}
+
+	// Dirty after a failed migration
+	migrationFs["migrations/0003_broken.sql"] = &fstest.MapFile{Data: []byte("-- +up\nCREATE TABLE;\n")}
+	if err := MigrateUp(db, migrationFs, "migrations"); err == nil {
+		t.Fatalf("Expected the broken migration to fail")
+	}
+	code, health = serveHealth(t, readinessHandler)
+	if code != http.StatusServiceUnavailable || !health.Dirty || health.PendingCount != 1 {
+		t.Fatalf("Unexpected readiness %d %+v", code, health)
+	}
+	if code, _ := serveHealth(t, healthHandler); code != http.StatusOK {
+		t.Fatalf("Expected the health handler to respond with 200, got %d", code)
+	}
+}
+
+// Replicas serve health checks while another goroutine migrates, run with -race
+func TestHealthHandlerConcurrentWithMigrateUp(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	SetDatabaseType(nil)
+	migrationFs := fstest.MapFS{}
+	for version := 1; version <= 10; version++ {
+		migrationFs[fmt.Sprintf("migrations/%04d_t%d.sql", version, version)] = &fstest.MapFile{
+			Data: []byte(fmt.Sprintf("-- +up\nCREATE TABLE t%d (id INT);\n", version)),
+		}
+	}
+	handler := HealthHandler(db, migrationFs, "migrations")
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+				if recorder.Code != http.StatusOK {
+					t.Errorf("Expected the health handler to respond with 200, got %d: %s",
+						recorder.Code, recorder.Body.String())
+					return
+				}
+			}
+		}()
+	}
+	err := MigrateUp(db, migrationFs, "migrations")
+	close(done)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+
+	code, health := serveHealth(t, handler)
+	if code != http.StatusOK || !health.Ready || health.InstalledVersion != 10 {
+		t.Fatalf("Unexpected health %d %+v", code, health)
+	}
+}
+
+func TestHealthAwaitingPostPhase(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := phasedMigrations()
+	if err := MigrateUpPhase(db, migrationFs, "migrations", PhasePre); err != nil {
+		t.Fatalf("MigrateUpPhase pre failed: %s", err)
+	}
+
+	// New code runs between the pre and post phase, so replicas are ready
+	health, err := Health(db, migrationFs, "migrations")
+	if err != nil {
+		t.Fatalf("Health failed: %s", err)
+	}
+	if !health.Ready || health.PendingCount != 0 || health.AwaitingPostPhase != 1 {
+		t.Fatalf("Unexpected health %+v", health)
+	}
+}
+
+func TestHealthOnBaselineSchema(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_a.sql": {Data: []byte("-- +up\nCREATE TABLE a (id INT);\n")},
+		"migrations/0002_b.sql": {Data: []byte("-- +up\nCREATE TABLE b (id INT);\n")},
+	}
+
+	// Only the migrations table of the first releases, without any newer bookkeeping tables
+	if _, err := db.Exec("CREATE TABLE migrations (version INT NOT NULL, installed_at TIMESTAMP NOT NULL)"); err != nil {
+		t.Fatalf("Failed to create migrations table: %s", err)
+	}
+	if _, err := db.Exec("INSERT INTO migrations (version, installed_at) VALUES (1, CURRENT_TIMESTAMP)"); err != nil {
+		t.Fatalf("Failed to insert migration: %s", err)
+	}
+
+	health, err := Health(db, migrationFs, "migrations")
+	if err != nil {
+		t.Fatalf("Health failed: %s", err)
+	}
+	if health.InstalledVersion != 1 || health.PendingCount != 1 || health.AwaitingPostPhase != 0 ||
+		health.Dirty || health.Ready || health.LastAppliedAt == nil {
+		t.Fatalf("Unexpected health %+v", health)
+	}
+	for _, table := range []string{"migration_phases", "migration_history"} {
+		if tableExists(t, db, table) {
+			t.Fatalf("Expected health not to create the %s table", table)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HistoryOperation is the kind of operation recorded in the migration history.
+type HistoryOperation string
+
+const (
+	HistoryUp         HistoryOperation = "up"         // Migration applied
+	HistoryUpPre      HistoryOperation = "up_pre"     // Pre phase of a migration applied
+	HistoryDown       HistoryOperation = "down"       // Migration reverted
+	HistoryBaseline   HistoryOperation = "baseline"   // Migration recorded as applied without running it
+	HistoryForce      HistoryOperation = "force"      // Recorded version changed without running migrations
+	HistoryRepeatable HistoryOperation = "repeatable" // Repeatable migration applied, recorded with version 0
+)
+
+// HistoryEntry is a single operation in the migration history.
+// It is emitted as JSON by `migrate history --format json`, field names are stable
+// and the duration is emitted in milliseconds as `duration_ms`.
+type HistoryEntry struct {
+	ID        int64            `json:"id"`
+	Version   int              `json:"version"`
+	Operation HistoryOperation `json:"operation"`
+	Checksum  string           `json:"checksum,omitempty"` // Checksum of the SQL that ran, empty when no SQL ran
+	Actor     string           `json:"actor"`
+	StartedAt time.Time        `json:"started_at"`
+	Duration  time.Duration    `json:"-"`
+	Success   bool             `json:"success"`
+	Error     string           `json:"error,omitempty"` // Error message when the operation failed
+}
+
+// MarshalJSON emits the entry with its duration in milliseconds
+func (e HistoryEntry) MarshalJSON() ([]byte, error) {
+	type entry HistoryEntry
+	return json.Marshal(struct {
+		entry
+		DurationMs int64 `json:"duration_ms"`
+	}{entry(e), e.Duration.Milliseconds()})
+}
+
+// History returns every recorded migration operation, oldest first.
+// MySQL connections need `parseTime=true` to read timestamps.
+func History(db *sql.DB) ([]HistoryEntry, error) {
+	return HistoryWith(SQLExecutor(db))
+}
+
+// HistoryWith works like History with queries run by an Executor.
+func HistoryWith(db Executor) ([]HistoryEntry, error) {
+	bound, err := withQueries(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationTableExists(bound); err != nil {
+		return nil, err
+	}
+	if bound.queries.SelectHistory == "" {
+		return nil, errors.New("migration history is not supported by the active query definition")
+	}
+
+	rows, err := bound.Query(bound.queries.SelectHistory)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migration history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var entry HistoryEntry
+		var checksum, errorMessage sql.NullString
+		var durationMs int64
+		err := rows.Scan(&entry.ID, &entry.Version, &entry.Operation, &checksum, &entry.Actor,
+			&entry.StartedAt, &durationMs, &entry.Success, &errorMessage)
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration history: %w", err)
+		}
+		entry.Checksum = checksum.String
+		entry.Error = errorMessage.String
+		entry.Duration = time.Duration(durationMs) * time.Millisecond
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading migration history: %w", err)
+	}
+	return entries, nil
+}
+
+// Baseline records every available migration up to version as applied without running them.
+// Intended for databases whose schema was created before using dbmigrator.
+// The migrations table must not contain any versions yet.
+func Baseline(db *sql.DB, migrationFs fs.FS, migrationDir string, version int) error {
+	return BaselineWith(SQLExecutor(db), migrationFs, migrationDir, version)
+}
+
+// BaselineWith works like Baseline with queries run by an Executor.
+func BaselineWith(db Executor, migrationFs fs.FS, migrationDir string, version int) error {
+	return withMigrationLock(db, func(db *queryExecutor) error {
+		return baseline(db, migrationFs, migrationDir, version)
+	})
+}
+
+// baseline records migrations up to version as applied while holding the migration lock
+func baseline(db *queryExecutor, migrationFs fs.FS, migrationDir string, version int) error {
+	liveState, err := getLiveMigrationInfo(db, migrationFs, migrationDir)
+	if err != nil {
+		return err
+	}
+	if liveState.InstalledVersion != 0 {
+		return fmt.Errorf("can not baseline, migrations table already contains version %d",
+			liveState.InstalledVersion)
+	}
+
+	for _, migration := range liveState.Migrations {
+		if migration.version > version {
+			break
+		}
+		startedAt := time.Now()
+		_, err := db.Exec(db.queries.InsertMigration, migration.version, startedAt)
+		if err != nil {
+			err = fmt.Errorf("error inserting migration version into migrations table %d: %w", migration.version, err)
+		}
+		recordHistory(db, HistoryBaseline, migration.version, "", startedAt, err)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Baselined database at version %d.\n", version)
+	return nil
+}
+
+// Force changes the recorded version without running any migrations.
+// Recorded versions above version are removed and unapplied available versions
+// up to version are recorded as applied.
+// Intended to recover after a failed migration was fixed by hand.
+func Force(db *sql.DB, migrationFs fs.FS, migrationDir string, version int) error {
+	return ForceWith(SQLExecutor(db), migrationFs, migrationDir, version)
+}
+
+// ForceWith works like Force with queries run by an Executor.
+func ForceWith(db Executor, migrationFs fs.FS, migrationDir string, version int) error {
+	return withMigrationLock(db, func(db *queryExecutor) error {
+		return force(db, migrationFs, migrationDir, version)
+	})
+}
+
+// force changes the recorded version while holding the migration lock
+func force(db *queryExecutor, migrationFs fs.FS, migrationDir string, version int) error {
+	liveState, err := getLiveMigrationInfo(db, migrationFs, migrationDir)
+	if err != nil {
+		return err
+	}
+
+	startedAt := time.Now()
+	err = forceVersion(db, liveState, version)
+	recordHistory(db, HistoryForce, version, "", startedAt, err)
+	if err != nil {
+		return err
+	}
+	log.Printf("Forced database to version %d.\n", version)
+	return nil
+}
+
+// forceVersion rewrites the migrations table to end at version in a single transaction
+func forceVersion(db *queryExecutor, liveState MigrationState, version int) error {
+	tx, err := db.Begin(nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+
+	// Remove versions above the forced version
+	applied := make(map[int]bool, len(liveState.AppliedVersions))
+	for _, appliedVersion := range liveState.AppliedVersions {
+		applied[appliedVersion] = true
+		if appliedVersion <= version {
+			continue
+		}
+		if _, err := tx.Exec(db.queries.DeleteMigration, appliedVersion); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error removing version from migrations table %d: %w", appliedVersion, err)
+		}
+		if err := deleteMigrationScript(db.queries, tx, appliedVersion); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	// Record versions up to the forced version
+	now := time.Now()
+	for _, migration := range liveState.Migrations {
+		if applied[migration.version] || migration.version > version {
+			continue
+		}
+		if db.queries.SelectAppliedVersions == "" && migration.version <= liveState.InstalledVersion {
+			continue
+		}
+		if _, err := tx.Exec(db.queries.InsertMigration, migration.version, now); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error inserting migration version into migrations table %d: %w", migration.version, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing forced version %d: %w", version, err)
+	}
+	return nil
+}
+
+// recordHistory appends an operation to the migration history and reports it to the configured metrics.
+// Failing to record history is logged but does not fail the operation.
+func recordHistory(db *queryExecutor, operation HistoryOperation, version int, sqlChecksum string, startedAt time.Time, opErr error) {
+	observeOperation(operation, version, startedAt, opErr)
+	if db.queries.InsertHistory == "" {
+		return
+	}
+	checksum := sql.NullString{String: sqlChecksum, Valid: sqlChecksum != ""}
+	errorMessage := sql.NullString{}
+	if opErr != nil {
+		errorMessage = sql.NullString{String: opErr.Error(), Valid: true}
+	}
+	_, err := db.Exec(db.queries.InsertHistory,
+		version,
+		string(operation),
+		checksum,
+		historyActor(),
+		startedAt,
+		time.Since(startedAt).Milliseconds(),
+		opErr == nil,
+		errorMessage)
+	if err != nil {
+		log.Warnf("Error recording %s of migration %d in history: %v", operation, version, err)
+	}
+}
+
+// historyActor returns the configured actor or user@host of the current process
+func historyActor() string {
+	if activeHistoryActor != "" {
+		return activeHistoryActor
+	}
+	actor := "unknown"
+	if current, err := user.Current(); err == nil {
+		actor = current.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		actor += "@" + host
+	}
+	return actor
+}
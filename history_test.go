@@ -0,0 +1,84 @@
+package dbmigrator
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestHistoryRecordsEveryOperation(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	SetHistoryActor("tester")
+	defer SetHistoryActor("")
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_two.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE two (id INT);\n-- +down\nDROP TABLE two;\n")},
+		"migrations/0003_broken.sql": {Data: []byte(
+			"-- +up\nTHIS IS NOT SQL;\n")},
+	}
+
+	if err := MigrateUp(db, migrationFs, "migrations"); err == nil {
+		t.Fatalf("Expected migration 3 to fail")
+	}
+	if err := MigrateDown(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateDown failed: %s", err)
+	}
+	if err := Force(db, migrationFs, "migrations", 0); err != nil {
+		t.Fatalf("Force failed: %s", err)
+	}
+	if err := Baseline(db, migrationFs, "migrations", 1); err != nil {
+		t.Fatalf("Baseline failed: %s", err)
+	}
+
+	entries, err := History(db)
+	if err != nil {
+		t.Fatalf("History failed: %s", err)
+	}
+	expected := []struct {
+		operation HistoryOperation
+		version   int
+		success   bool
+	}{
+		{HistoryUp, 1, true},
+		{HistoryUp, 2, true},
+		{HistoryUp, 3, false},
+		{HistoryDown, 2, true},
+		{HistoryForce, 0, true},
+		{HistoryBaseline, 1, true},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d history entries, got %d: %+v", len(expected), len(entries), entries)
+	}
+	for i, entry := range entries {
+		if entry.Operation != expected[i].operation ||
+			entry.Version != expected[i].version ||
+			entry.Success != expected[i].success ||
+			entry.Actor != "tester" {
+			t.Fatalf("Unexpected history entry %d: %+v", i, entry)
+		}
+	}
+	if entries[2].Error == "" {
+		t.Fatalf("Expected failed entry to record the error")
+	}
+
+	// Installed version semantics are unaffected by the history
+	version, err := getInstalledMigrationVersion(bindTestQueries(t, SQLExecutor(db)))
+	if err != nil || version != 1 {
+		t.Fatalf("Expected installed version 1, got %d (%v)", version, err)
+	}
+}
+
+func TestHistoryDetectsDialect(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	SetDatabaseType(nil)
+
+	// History is the first call on a fresh database without a configured dialect
+	entries, err := History(db)
+	if err != nil {
+		t.Fatalf("History failed: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("Expected no history on a fresh database, got %+v", entries)
+	}
+}
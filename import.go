@@ -0,0 +1,594 @@
+package dbmigrator
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ImportSource identifies the migration tool a migration set is imported from.
+type ImportSource string
+
+const (
+	ImportGoose         ImportSource = "goose"
+	ImportGolangMigrate ImportSource = "golang-migrate"
+	ImportFlyway        ImportSource = "flyway"
+)
+
+// ImportedMigration describes a migration converted from another tool.
+type ImportedMigration struct {
+	SourceVersion string // Version as known by the source tool
+	Version       int    // Version assigned by dbmigrator
+	File          string // Path of the written dbmigrator migration file
+}
+
+// sourceMigration is a migration read from another tool's migration set
+type sourceMigration struct {
+	parts      []int64 // numeric version parts, used for ordering
+	name       string
+	file       string
+	repeatable bool
+	contents   migrationContents
+}
+
+var (
+	gooseFileRx         = regexp.MustCompile(`^(\d+)_(.+)\.(sql|go)$`)
+	gooseAnnotationRx   = regexp.MustCompile(`(?i)^\s*--\s*\+goose\s+(\w+)`)
+	golangMigrateFileRx = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+	flywayFileRx        = regexp.MustCompile(`^([VU])(\d+(?:[._]\d+)*)__(.+)\.sql$`)
+	flywayRepeatableRx  = regexp.MustCompile(`^R__(.+)\.sql$`)
+	unsafeNameCharsRx   = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// Import converts the migration set of another tool into dbmigrator migrations
+// and records the versions the other tool had applied in the migrations table,
+// so no migration is re-run.
+//
+// Param: source - tool the migrations in sourceDir were written for
+//
+// Param: sourceFs, sourceDir - location of the migrations to import
+//
+// Param: targetDir - directory on disk to write the dbmigrator migrations to
+func Import(db *sql.DB, source ImportSource, sourceFs fs.FS, sourceDir string, targetDir string) error {
+	return ImportWith(SQLExecutor(db), source, sourceFs, sourceDir, targetDir)
+}
+
+// ImportWith works like Import with queries run by an Executor.
+func ImportWith(db Executor, source ImportSource, sourceFs fs.FS, sourceDir string, targetDir string) error {
+	imported, err := ImportMigrationFiles(source, sourceFs, sourceDir, targetDir)
+	if err != nil {
+		return err
+	}
+	_, err = ImportAppliedVersionsWith(db, source, imported)
+	return err
+}
+
+// ImportMigrationFiles converts the migration files of another tool into
+// dbmigrator migration files written to targetDir.
+// Versions are renumbered sequentially in the order the source tool applies them.
+func ImportMigrationFiles(source ImportSource, sourceFs fs.FS, sourceDir string, targetDir string) ([]ImportedMigration, error) {
+	var migrations []sourceMigration
+	var err error
+	switch source {
+	case ImportGoose:
+		migrations, err = readGooseMigrations(sourceFs, sourceDir)
+	case ImportGolangMigrate:
+		migrations, err = readGolangMigrateMigrations(sourceFs, sourceDir)
+	case ImportFlyway:
+		migrations, err = readFlywayMigrations(sourceFs, sourceDir)
+	default:
+		return nil, fmt.Errorf("unknown import source: %s", source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	migrations, repeatables := splitRepeatableSourceMigrations(migrations)
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("no %s migrations found in %s", source, sourceDir)
+	}
+	if len(migrations) > 9999 {
+		return nil, fmt.Errorf("can not import %d migrations, the maximum is 9999", len(migrations))
+	}
+
+	// Sort in the order the source tool applies them
+	sort.Slice(migrations, func(i, j int) bool {
+		return compareVersionParts(migrations[i].parts, migrations[j].parts) < 0
+	})
+	for i := 1; i < len(migrations); i++ {
+		if compareVersionParts(migrations[i-1].parts, migrations[i].parts) == 0 {
+			return nil, fmt.Errorf("duplicate %s migration version: %s",
+				source, versionPartsString(migrations[i].parts))
+		}
+	}
+
+	// Write dbmigrator files
+	if err := os.MkdirAll(targetDir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating migrations directory: %w", err)
+	}
+	imported := make([]ImportedMigration, 0, len(migrations))
+	for i, migration := range migrations {
+		version := i + 1
+		target := filepath.Join(targetDir, fmt.Sprintf("%04d_%s.sql", version, migration.name))
+		contents := fmt.Sprintf("-- Imported from %s migration %s\n-- +up\n%s\n",
+			source, migration.file, strings.TrimRight(migration.contents.up, "\n"))
+		if strings.TrimSpace(migration.contents.down) != "" {
+			contents += "-- +down\n" + migration.contents.down
+		}
+		if err := writeNewFile(target, contents); err != nil {
+			return nil, err
+		}
+		imported = append(imported, ImportedMigration{
+			SourceVersion: versionPartsString(migration.parts),
+			Version:       version,
+			File:          target,
+		})
+	}
+	for _, repeatable := range repeatables {
+		target := filepath.Join(targetDir, fmt.Sprintf("R_%s.sql", repeatable.name))
+		contents := fmt.Sprintf("-- Imported from %s repeatable migration %s\n-- +up\n%s",
+			source, repeatable.file, repeatable.contents.up)
+		if err := writeNewFile(target, contents); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("Imported %d %s migrations into %s.\n", len(imported), source, targetDir)
+	return imported, nil
+}
+
+// ImportAppliedVersions reads the version table of the source tool and records
+// the imported migrations it had applied in the migrations table.
+// The migrations table must not contain any versions yet.
+//
+// Returns: number of versions recorded as applied
+func ImportAppliedVersions(db *sql.DB, source ImportSource, imported []ImportedMigration) (int, error) {
+	return ImportAppliedVersionsWith(SQLExecutor(db), source, imported)
+}
+
+// ImportAppliedVersionsWith works like ImportAppliedVersions with queries run by an Executor.
+func ImportAppliedVersionsWith(db Executor, source ImportSource, imported []ImportedMigration) (int, error) {
+	bound, err := withQueries(db)
+	if err != nil {
+		return 0, err
+	}
+	installedVersion, err := getInstalledMigrationVersion(bound)
+	if err != nil {
+		return 0, err
+	}
+	if installedVersion != 0 {
+		return 0, fmt.Errorf(
+			"migrations table already contains version %d, refusing to import applied versions",
+			installedVersion)
+	}
+
+	// Collect applied versions from the source tool's version table
+	var applied map[string]bool
+	switch source {
+	case ImportGoose:
+		applied, err = readGooseAppliedVersions(db)
+	case ImportGolangMigrate:
+		applied, err = readGolangMigrateAppliedVersions(db, imported)
+	case ImportFlyway:
+		applied, err = readFlywayAppliedVersions(db, imported)
+	default:
+		return 0, fmt.Errorf("unknown import source: %s", source)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Map applied source versions onto imported versions
+	var versions []int
+	for _, migration := range imported {
+		if applied[migration.SourceVersion] {
+			versions = append(versions, migration.Version)
+		}
+	}
+	for i, version := range versions {
+		if version != i+1 {
+			log.Warnf("Applied %s migrations are not contiguous, version %d and later may not be applied in order.",
+				source, i+1)
+			break
+		}
+	}
+
+	// Record applied versions
+	tx, err := bound.Begin(nil)
+	if err != nil {
+		return 0, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	now := time.Now()
+	for _, version := range versions {
+		if _, err := tx.Exec(bound.queries.InsertMigration, version, now); err != nil {
+			_ = tx.Rollback()
+			return 0, fmt.Errorf("error inserting migration version into migrations table %d: %w", version, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing imported versions: %w", err)
+	}
+	for _, version := range versions {
+		recordHistory(bound, HistoryBaseline, version, "", now, nil)
+	}
+	log.Printf("Recorded %d applied %s migrations.\n", len(versions), source)
+	return len(versions), nil
+}
+
+// readGooseMigrations reads goose migrations with `-- +goose Up` and `-- +goose Down` annotations.
+// Go migrations and migrations annotated with `-- +goose NO TRANSACTION` fail the import,
+// dbmigrator runs every migration from SQL in a transaction.
+func readGooseMigrations(sourceFs fs.FS, sourceDir string) ([]sourceMigration, error) {
+	var migrations []sourceMigration
+	err := walkSourceFiles(sourceFs, sourceDir, func(file string) error {
+		matches := gooseFileRx.FindStringSubmatch(path.Base(file))
+		if matches == nil {
+			return nil
+		}
+		if matches[3] == "go" {
+			return fmt.Errorf("goose Go migrations can not be imported, "+
+				"rewrite %s in SQL or move it out of the source directory", file)
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing goose migration version %s: %w", file, err)
+		}
+		contents, err := fs.ReadFile(sourceFs, file)
+		if err != nil {
+			return fmt.Errorf("error reading migration file: %w", err)
+		}
+
+		// Translate annotations
+		var up, down strings.Builder
+		var section *strings.Builder
+		scanner := bufio.NewScanner(strings.NewReader(string(contents)))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if annotation := gooseAnnotationRx.FindStringSubmatch(line); annotation != nil {
+				switch strings.ToLower(annotation[1]) {
+				case "up":
+					section = &up
+				case "down":
+					section = &down
+				case "no":
+					return fmt.Errorf("goose migration %s runs outside a transaction with `-- +goose NO TRANSACTION`, "+
+						"which dbmigrator does not support", file)
+				}
+				// StatementBegin, StatementEnd and envsub have no equivalent
+				continue
+			}
+			if section != nil {
+				section.WriteString(line)
+				section.WriteString("\n")
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("error reading migration file: %w", err)
+		}
+
+		migrations = append(migrations, sourceMigration{
+			parts:    []int64{version},
+			name:     sanitizeMigrationName(matches[2]),
+			file:     file,
+			contents: migrationContents{up: up.String(), down: down.String()},
+		})
+		return nil
+	})
+	return migrations, err
+}
+
+// readGolangMigrateMigrations reads golang-migrate `.up.sql` and `.down.sql` pairs
+func readGolangMigrateMigrations(sourceFs fs.FS, sourceDir string) ([]sourceMigration, error) {
+	migrationMap := make(map[int64]*sourceMigration)
+	err := walkSourceFiles(sourceFs, sourceDir, func(file string) error {
+		matches := golangMigrateFileRx.FindStringSubmatch(path.Base(file))
+		if matches == nil {
+			return nil
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing golang-migrate migration version %s: %w", file, err)
+		}
+		contents, err := fs.ReadFile(sourceFs, file)
+		if err != nil {
+			return fmt.Errorf("error reading migration file: %w", err)
+		}
+
+		migration, exists := migrationMap[version]
+		if !exists {
+			migration = &sourceMigration{
+				parts: []int64{version},
+				name:  sanitizeMigrationName(matches[2]),
+			}
+			migrationMap[version] = migration
+		}
+		if matches[3] == "up" {
+			if migration.file != "" {
+				return fmt.Errorf("duplicate golang-migrate up migration version: %d", version)
+			}
+			migration.file = file
+			migration.contents.up = string(contents)
+		} else {
+			migration.contents.down = string(contents)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]sourceMigration, 0, len(migrationMap))
+	for version, migration := range migrationMap {
+		if migration.file == "" {
+			return nil, fmt.Errorf("golang-migrate migration %d has a down file but no up file", version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	return migrations, nil
+}
+
+// readFlywayMigrations reads Flyway versioned migrations (`V1__name.sql`)
+// along with their undo migrations (`U1__name.sql`) when present,
+// and repeatable migrations (`R__name.sql`).
+func readFlywayMigrations(sourceFs fs.FS, sourceDir string) ([]sourceMigration, error) {
+	migrationMap := make(map[string]*sourceMigration)
+	undoMap := make(map[string]string)
+	var repeatables []sourceMigration
+	err := walkSourceFiles(sourceFs, sourceDir, func(file string) error {
+		base := path.Base(file)
+		if matches := flywayRepeatableRx.FindStringSubmatch(base); matches != nil {
+			contents, err := fs.ReadFile(sourceFs, file)
+			if err != nil {
+				return fmt.Errorf("error reading migration file: %w", err)
+			}
+			repeatables = append(repeatables, sourceMigration{
+				name:       sanitizeMigrationName(matches[1]),
+				file:       file,
+				repeatable: true,
+				contents:   migrationContents{up: string(contents)},
+			})
+			return nil
+		}
+		matches := flywayFileRx.FindStringSubmatch(base)
+		if matches == nil {
+			return nil
+		}
+		parts, err := parseVersionParts(matches[2])
+		if err != nil {
+			return fmt.Errorf("error parsing Flyway migration version %s: %w", file, err)
+		}
+		key := versionPartsString(parts)
+		contents, err := fs.ReadFile(sourceFs, file)
+		if err != nil {
+			return fmt.Errorf("error reading migration file: %w", err)
+		}
+
+		if matches[1] == "U" {
+			undoMap[key] = string(contents)
+			return nil
+		}
+		if _, exists := migrationMap[key]; exists {
+			return fmt.Errorf("duplicate Flyway migration version: %s", key)
+		}
+		migrationMap[key] = &sourceMigration{
+			parts:    parts,
+			name:     sanitizeMigrationName(matches[3]),
+			file:     file,
+			contents: migrationContents{up: string(contents)},
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]sourceMigration, 0, len(migrationMap)+len(repeatables))
+	for key, migration := range migrationMap {
+		migration.contents.down = undoMap[key]
+		migrations = append(migrations, *migration)
+	}
+	return append(migrations, repeatables...), nil
+}
+
+// readGooseAppliedVersions replays goose_db_version to find the applied versions
+func readGooseAppliedVersions(db Executor) (map[string]bool, error) {
+	rows, err := db.Query("SELECT version_id, is_applied FROM goose_db_version ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error reading goose_db_version: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		if err := rows.Scan(&version, &isApplied); err != nil {
+			return nil, fmt.Errorf("error reading goose_db_version: %w", err)
+		}
+		applied[versionPartsString([]int64{version})] = isApplied
+	}
+	return applied, rows.Err()
+}
+
+// readGolangMigrateAppliedVersions reads the current version from schema_migrations.
+// golang-migrate only stores the latest version, every version up to it is applied.
+func readGolangMigrateAppliedVersions(db Executor, imported []ImportedMigration) (map[string]bool, error) {
+	var version int64
+	var dirty bool
+	err := db.QueryRow("SELECT version, dirty FROM schema_migrations").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return map[string]bool{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	if dirty {
+		return nil, fmt.Errorf("golang-migrate database is dirty at version %d, fix it before importing", version)
+	}
+
+	applied := make(map[string]bool)
+	for _, migration := range imported {
+		parts, err := parseVersionParts(migration.SourceVersion)
+		if err != nil {
+			return nil, err
+		}
+		applied[migration.SourceVersion] = compareVersionParts(parts, []int64{version}) <= 0
+	}
+	return applied, nil
+}
+
+// readFlywayAppliedVersions replays flyway_schema_history to find the applied versions
+func readFlywayAppliedVersions(db Executor, imported []ImportedMigration) (map[string]bool, error) {
+	rows, err := db.Query(
+		"SELECT version, type, success FROM flyway_schema_history ORDER BY installed_rank")
+	if err != nil {
+		return nil, fmt.Errorf("error reading flyway_schema_history: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[string]bool)
+	var baseline []int64
+	for rows.Next() {
+		var version sql.NullString
+		var migrationType string
+		var success bool
+		if err := rows.Scan(&version, &migrationType, &success); err != nil {
+			return nil, fmt.Errorf("error reading flyway_schema_history: %w", err)
+		}
+		if !success || !version.Valid {
+			continue
+		}
+		parts, err := parseVersionParts(version.String)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case migrationType == "BASELINE":
+			baseline = parts
+		case strings.HasPrefix(migrationType, "UNDO"):
+			applied[versionPartsString(parts)] = false
+		default:
+			applied[versionPartsString(parts)] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading flyway_schema_history: %w", err)
+	}
+
+	// Versions up to the baseline count as applied
+	if baseline != nil {
+		for _, migration := range imported {
+			parts, err := parseVersionParts(migration.SourceVersion)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := applied[migration.SourceVersion]; !exists &&
+				compareVersionParts(parts, baseline) <= 0 {
+				applied[migration.SourceVersion] = true
+			}
+		}
+	}
+	return applied, nil
+}
+
+// splitRepeatableSourceMigrations separates versioned migrations from repeatable migrations
+func splitRepeatableSourceMigrations(migrations []sourceMigration) (versioned, repeatable []sourceMigration) {
+	for _, migration := range migrations {
+		if migration.repeatable {
+			repeatable = append(repeatable, migration)
+		} else {
+			versioned = append(versioned, migration)
+		}
+	}
+	return versioned, repeatable
+}
+
+// walkSourceFiles calls fn for every file in dir
+func walkSourceFiles(sourceFs fs.FS, dir string, fn func(file string) error) error {
+	return fs.WalkDir(sourceFs, dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		return fn(file)
+	})
+}
+
+// writeNewFile writes contents to file, refusing to overwrite existing files
+func writeNewFile(file string, contents string) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("error creating migration file: %w", err)
+	}
+	if _, err := f.WriteString(contents); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing migration file: %w", err)
+	}
+	return f.Close()
+}
+
+// sanitizeMigrationName turns a migration description into a valid file name part
+func sanitizeMigrationName(name string) string {
+	name = strings.Trim(unsafeNameCharsRx.ReplaceAllString(name, "_"), "_")
+	if name == "" {
+		return "imported"
+	}
+	return name
+}
+
+// parseVersionParts parses versions such as `42`, `1.2` or `1_2`
+func parseVersionParts(version string) ([]int64, error) {
+	fields := strings.FieldsFunc(version, func(r rune) bool { return r == '.' || r == '_' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid migration version: %q", version)
+	}
+	parts := make([]int64, len(fields))
+	for i, field := range fields {
+		part, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version: %q", version)
+		}
+		parts[i] = part
+	}
+	return parts, nil
+}
+
+// versionPartsString formats version parts as a dotted version without leading zeros
+func versionPartsString(parts []int64) string {
+	fields := make([]string, len(parts))
+	for i, part := range parts {
+		fields[i] = strconv.FormatInt(part, 10)
+	}
+	return strings.Join(fields, ".")
+}
+
+// compareVersionParts compares dotted versions numerically, missing parts count as 0
+func compareVersionParts(a, b []int64) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int64
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
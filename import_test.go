@@ -0,0 +1,163 @@
+package dbmigrator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestImportGoose(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	sourceFs := fstest.MapFS{
+		"20230101120000_create_users.sql": {Data: []byte(
+			"-- +goose Up\n-- +goose StatementBegin\nCREATE TABLE users (id INT);\n-- +goose StatementEnd\n" +
+				"-- +goose Down\nDROP TABLE users;\n")},
+		"20230102120000_create_posts.sql": {Data: []byte(
+			"-- +goose Up\nCREATE TABLE posts (id INT);\n-- +goose Down\nDROP TABLE posts;\n")},
+	}
+	for _, q := range []string{
+		"CREATE TABLE goose_db_version (id INTEGER PRIMARY KEY, version_id INT, is_applied BOOLEAN)",
+		"INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, 1), (20230101120000, 1), (20230102120000, 1), (20230102120000, 0)",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("Failed to set up goose_db_version: %s", err)
+		}
+	}
+
+	targetDir := filepath.Join(t.TempDir(), "migrations")
+	if err := Import(db, ImportGoose, sourceFs, ".", targetDir); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+
+	// Files are renumbered and annotations translated
+	contents, err := os.ReadFile(filepath.Join(targetDir, "0001_create_users.sql"))
+	if err != nil {
+		t.Fatalf("Expected converted migration file: %s", err)
+	}
+	if !strings.Contains(string(contents), "-- +up\nCREATE TABLE users (id INT);\n-- +down\nDROP TABLE users;") {
+		t.Fatalf("Unexpected converted contents:\n%s", contents)
+	}
+	if strings.Contains(string(contents), "StatementBegin") {
+		t.Fatalf("goose annotations were not removed:\n%s", contents)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "0002_create_posts.sql")); err != nil {
+		t.Fatalf("Expected second converted migration file: %s", err)
+	}
+
+	// The second migration was rolled back in goose so only version 1 is applied
+	version, err := getInstalledMigrationVersion(bindTestQueries(t, SQLExecutor(db)))
+	if err != nil || version != 1 {
+		t.Fatalf("Expected installed version 1, got %d (%v)", version, err)
+	}
+}
+
+func TestImportGooseUnsupportedMigrations(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		file  string
+		data  string
+		error string
+	}{
+		{"go migration", "20230102120000_backfill.go", "package migrations\n", "Go migrations can not be imported"},
+		{"no transaction", "20230102120000_create_index.sql",
+			"-- +goose NO TRANSACTION\n-- +goose Up\nCREATE INDEX CONCURRENTLY users_id ON users (id);\n",
+			"NO TRANSACTION"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sourceFs := fstest.MapFS{
+				"20230101120000_create_users.sql": {Data: []byte("-- +goose Up\nCREATE TABLE users (id INT);\n")},
+				test.file:                         {Data: []byte(test.data)},
+			}
+			targetDir := filepath.Join(t.TempDir(), "migrations")
+			_, err := ImportMigrationFiles(ImportGoose, sourceFs, ".", targetDir)
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Fatalf("Expected the import to fail with %q, got %v", test.error, err)
+			}
+			if _, err := os.Stat(filepath.Join(targetDir, "0001_create_users.sql")); !os.IsNotExist(err) {
+				t.Fatalf("Expected no migration files to be written, got %v", err)
+			}
+		})
+	}
+}
+
+func TestImportGolangMigrate(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	sourceFs := fstest.MapFS{
+		"sql/1_one.up.sql":     {Data: []byte("CREATE TABLE one (id INT);\n")},
+		"sql/1_one.down.sql":   {Data: []byte("DROP TABLE one;\n")},
+		"sql/2_two.up.sql":     {Data: []byte("CREATE TABLE two (id INT);\n")},
+		"sql/3_three.up.sql":   {Data: []byte("CREATE TABLE three (id INT);\n")},
+		"sql/3_three.down.sql": {Data: []byte("DROP TABLE three;\n")},
+	}
+	for _, q := range []string{
+		"CREATE TABLE schema_migrations (version BIGINT, dirty BOOLEAN)",
+		"INSERT INTO schema_migrations (version, dirty) VALUES (2, 0)",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("Failed to set up schema_migrations: %s", err)
+		}
+	}
+
+	targetDir := t.TempDir()
+	if err := Import(db, ImportGolangMigrate, sourceFs, "sql", targetDir); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	version, err := getInstalledMigrationVersion(bindTestQueries(t, SQLExecutor(db)))
+	if err != nil || version != 2 {
+		t.Fatalf("Expected installed version 2, got %d (%v)", version, err)
+	}
+
+	// Importing into a database that already has versions is refused
+	if _, err := ImportAppliedVersions(db, ImportGolangMigrate, nil); err == nil {
+		t.Fatalf("Expected second import of applied versions to fail")
+	}
+}
+
+func TestImportFlyway(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	sourceFs := fstest.MapFS{
+		"V1__Create_users.sql":  {Data: []byte("CREATE TABLE users (id INT);\n")},
+		"U1__Create_users.sql":  {Data: []byte("DROP TABLE users;\n")},
+		"V1_1__Add_email.sql":   {Data: []byte("ALTER TABLE users ADD email TEXT;\n")},
+		"V2__Create_posts.sql":  {Data: []byte("CREATE TABLE posts (id INT);\n")},
+		"R__Refresh_views.sql":  {Data: []byte("SELECT 1;\n")},
+		"V10__Create_likes.sql": {Data: []byte("CREATE TABLE likes (id INT);\n")},
+	}
+	for _, q := range []string{
+		"CREATE TABLE flyway_schema_history (installed_rank INT, version TEXT, type TEXT, success BOOLEAN)",
+		"INSERT INTO flyway_schema_history VALUES (1, '1', 'SQL', 1), (2, '1.1', 'SQL', 1), (3, NULL, 'SQL', 1), (4, '2', 'SQL', 0)",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("Failed to set up flyway_schema_history: %s", err)
+		}
+	}
+
+	targetDir := t.TempDir()
+	imported, err := ImportMigrationFiles(ImportFlyway, sourceFs, ".", targetDir)
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	expected := []string{"1", "1.1", "2", "10"}
+	if len(imported) != len(expected) {
+		t.Fatalf("Expected %d imported migrations, got %d", len(expected), len(imported))
+	}
+	for i, migration := range imported {
+		if migration.SourceVersion != expected[i] || migration.Version != i+1 {
+			t.Fatalf("Unexpected import order: %+v", imported)
+		}
+	}
+	contents, err := os.ReadFile(filepath.Join(targetDir, "0001_Create_users.sql"))
+	if err != nil || !strings.Contains(string(contents), "-- +down\nDROP TABLE users;") {
+		t.Fatalf("Expected undo migration to become the down section:\n%s", contents)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "R_Refresh_views.sql")); err != nil {
+		t.Fatalf("Expected repeatable migration to be imported: %s", err)
+	}
+
+	count, err := ImportAppliedVersions(db, ImportFlyway, imported)
+	if err != nil || count != 2 {
+		t.Fatalf("Expected 2 applied versions, got %d (%v)", count, err)
+	}
+}
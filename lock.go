@@ -0,0 +1,127 @@
+package dbmigrator
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LockStrategy is how a dialect serializes concurrent migrators,
+// such as multiple replicas of a service starting at the same time.
+type LockStrategy string
+
+const (
+	// LockNone does not lock, for in-process databases.
+	LockNone LockStrategy = ""
+
+	// LockAdvisory holds a session level lock, such as pg_try_advisory_lock, on a dedicated connection.
+	// AcquireLock returns 1 when the lock was acquired and 0 while another migrator holds it.
+	LockAdvisory LockStrategy = "advisory"
+
+	// LockTable inserts a row into a lock table, for databases without session level locks.
+	// AcquireLock fails while another migrator holds the lock.
+	LockTable LockStrategy = "table"
+)
+
+// lockRetryInterval is how often acquiring a held migration lock is retried
+const lockRetryInterval = time.Second
+
+// withMigrationLock runs fn while holding the migration lock of the dialect of db,
+// passing it db bound to its query set
+func withMigrationLock(db Executor, fn func(db *queryExecutor) error) error {
+	bound, err := withQueries(db)
+	if err != nil {
+		return err
+	}
+	startedAt := time.Now()
+	release, err := acquireMigrationLock(bound)
+	observeLockWait(startedAt)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn(bound)
+}
+
+// acquireMigrationLock acquires the migration lock, retrying until the lock timeout,
+// and returns the function releasing it
+func acquireMigrationLock(db *queryExecutor) (func(), error) {
+	var tryLock func() error
+	var release func()
+	switch db.queries.LockStrategy {
+	case LockAdvisory:
+		// Session level locks are released with the connection that acquired them
+		session, closeSession, err := db.Session()
+		if err != nil {
+			return nil, fmt.Errorf("error getting database connection: %w", err)
+		}
+		tryLock = func() error {
+			var acquired int
+			if err := session.QueryRow(db.queries.AcquireLock).Scan(&acquired); err != nil {
+				return err
+			}
+			if acquired != 1 {
+				return fmt.Errorf("lock is held by another migrator")
+			}
+			return nil
+		}
+		release = func() {
+			if _, err := session.Exec(db.queries.ReleaseLock); err != nil {
+				log.Warnf("Error releasing migration lock: %v", err)
+			}
+			_ = closeSession()
+		}
+		if err := retryLock(tryLock); err != nil {
+			_ = closeSession()
+			return nil, err
+		}
+		return release, nil
+
+	case LockTable:
+		if _, err := db.Exec(db.queries.CreateLockTable); err != nil {
+			return nil, fmt.Errorf("error creating migration lock table: %w", err)
+		}
+		// Each attempt runs in its own transaction, a savepoint in a caller's transaction,
+		// so a failed attempt does not abort the transaction
+		tryLock = func() error {
+			tx, err := db.Begin(nil)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(db.queries.AcquireLock, time.Now(), historyActor()); err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+			return tx.Commit()
+		}
+		if err := retryLock(tryLock); err != nil {
+			return nil, fmt.Errorf("%w, it may be held by a crashed migrator "+
+				"and can be removed from the lock table by hand", err)
+		}
+		return func() {
+			if _, err := db.Exec(db.queries.ReleaseLock); err != nil {
+				log.Warnf("Error releasing migration lock: %v", err)
+			}
+		}, nil
+
+	default:
+		return func() {}, nil
+	}
+}
+
+// retryLock calls tryLock until it succeeds or the lock timeout expires
+func retryLock(tryLock func() error) error {
+	deadline := time.Now().Add(activeLockTimeout)
+	for {
+		err := tryLock()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("migration lock was not acquired within %s: %w", activeLockTimeout, err)
+		}
+		log.Debugf("Waiting for migration lock: %v", err)
+		time.Sleep(min(lockRetryInterval, activeLockTimeout))
+	}
+}
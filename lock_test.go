@@ -0,0 +1,86 @@
+package dbmigrator
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestTableLock(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	queries := *SQLite
+	queries.LockStrategy = LockTable
+	queries.CreateLockTable = "CREATE TABLE IF NOT EXISTS migration_lock (id INT NOT NULL PRIMARY KEY, locked_at TIMESTAMP NOT NULL, locked_by VARCHAR(255) NOT NULL)"
+	queries.AcquireLock = "INSERT INTO migration_lock (id, locked_at, locked_by) VALUES (1, ?, ?)"
+	queries.ReleaseLock = "DELETE FROM migration_lock WHERE id = 1"
+	SetDatabaseType(&queries)
+	SetLockTimeout(100 * time.Millisecond)
+	defer SetLockTimeout(10 * time.Minute)
+
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+	}
+
+	// Another migrator holds the lock
+	if _, err := db.Exec(queries.CreateLockTable); err != nil {
+		t.Fatalf("Failed to create lock table: %s", err)
+	}
+	if _, err := db.Exec(queries.AcquireLock, time.Now(), "other"); err != nil {
+		t.Fatalf("Failed to acquire lock: %s", err)
+	}
+	err := MigrateUp(db, migrationFs, "migrations")
+	if err == nil || !strings.Contains(err.Error(), "migration lock was not acquired") {
+		t.Fatalf("Expected migrating to time out waiting for the lock, got %v", err)
+	}
+	if tableExists(t, db, "one") {
+		t.Fatalf("Expected no migrations to run without the lock")
+	}
+
+	// The lock is released after migrating
+	if _, err := db.Exec(queries.ReleaseLock); err != nil {
+		t.Fatalf("Failed to release lock: %s", err)
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+	var held int
+	if err := db.QueryRow("SELECT COUNT(*) FROM migration_lock").Scan(&held); err != nil || held != 0 {
+		t.Fatalf("Expected the lock to be released, got %d rows (%v)", held, err)
+	}
+}
+
+func TestStatementsOutsideTransaction(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	queries := *SQLite
+	queries.StatementsOutsideTransaction = true
+	SetDatabaseType(&queries)
+
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\nCREATE TABLE one_copy (id INT);\n" +
+				"-- +down\nDROP TABLE one_copy;\nDROP TABLE one;\n")},
+		"migrations/0002_broken.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE two (id INT);\nINSERT INTO missing VALUES (1);\n")},
+	}
+
+	// Statements that ran before a failing statement are not rolled back
+	err := MigrateUp(db, migrationFs, "migrations")
+	if err == nil || !strings.Contains(err.Error(), "partially applied") {
+		t.Fatalf("Expected the broken migration to fail, got %v", err)
+	}
+	if !tableExists(t, db, "one_copy") || !tableExists(t, db, "two") {
+		t.Fatalf("Expected every statement before the failure to be applied")
+	}
+	status, err := Status(db, migrationFs, "migrations")
+	if err != nil || status.InstalledVersion != 1 {
+		t.Fatalf("Expected version 1 to be installed, got %+v, %v", status, err)
+	}
+
+	if err := MigrateDown(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateDown failed: %s", err)
+	}
+	if tableExists(t, db, "one") || tableExists(t, db, "one_copy") {
+		t.Fatalf("Expected every down statement to be applied")
+	}
+}
@@ -0,0 +1,51 @@
+package dbmigrator
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Metrics receives measurements of migration runs, set with SetMetrics.
+// See the prommetrics package for a Prometheus collector.
+// Methods are called from the goroutine running the migration.
+type Metrics interface {
+	// ObserveOperation is called after each migration operation recorded in the history,
+	// err is nil when it succeeded.
+	ObserveOperation(operation HistoryOperation, version int, duration time.Duration, err error)
+
+	// ObserveLockWait is called with the time spent acquiring the migration lock.
+	ObserveLockWait(duration time.Duration)
+
+	// SetVersions is called with the installed and available versions whenever they are read
+	// and after migrating.
+	SetVersions(installed int, available int)
+}
+
+// observeOperation reports a completed migration operation to the configured metrics
+func observeOperation(operation HistoryOperation, version int, startedAt time.Time, err error) {
+	if activeMetrics != nil {
+		activeMetrics.ObserveOperation(operation, version, time.Since(startedAt), err)
+	}
+}
+
+// observeLockWait reports the time spent acquiring the migration lock to the configured metrics
+func observeLockWait(startedAt time.Time) {
+	if activeMetrics != nil {
+		activeMetrics.ObserveLockWait(time.Since(startedAt))
+	}
+}
+
+// reportVersions reads the installed version after migrating, including partially failed runs,
+// and reports it to the configured metrics
+func reportVersions(db *queryExecutor, available int) {
+	if activeMetrics == nil {
+		return
+	}
+	installed, err := getInstalledMigrationVersion(db)
+	if err != nil {
+		log.Warnf("Error reading installed version for metrics: %v", err)
+		return
+	}
+	activeMetrics.SetVersions(installed, available)
+}
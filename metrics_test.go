@@ -0,0 +1,85 @@
+package dbmigrator
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// recordedMetrics records the measurements it receives
+type recordedMetrics struct {
+	operations []string
+	lockWaits  int
+	versions   [2]int
+}
+
+func (m *recordedMetrics) ObserveOperation(operation HistoryOperation, version int, duration time.Duration, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "failed"
+	}
+	m.operations = append(m.operations, string(operation)+" "+outcome)
+}
+
+func (m *recordedMetrics) ObserveLockWait(duration time.Duration) {
+	m.lockWaits++
+}
+
+func (m *recordedMetrics) SetVersions(installed int, available int) {
+	m.versions = [2]int{installed, available}
+}
+
+func TestMetrics(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	metrics := &recordedMetrics{}
+	SetMetrics(metrics)
+	defer SetMetrics(nil)
+
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_bad.sql": {Data: []byte("-- +up\nCREATE TABLE;\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err == nil {
+		t.Fatalf("Expected migration 2 to fail")
+	}
+	if err := MigrateDown(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateDown failed: %s", err)
+	}
+
+	if !reflect.DeepEqual(metrics.operations, []string{"up ok", "up failed", "down ok"}) {
+		t.Fatalf("Unexpected operations %v", metrics.operations)
+	}
+	if metrics.lockWaits != 2 || metrics.versions != [2]int{0, 2} {
+		t.Fatalf("Unexpected lock waits %d and versions %v", metrics.lockWaits, metrics.versions)
+	}
+}
+
+func TestMetricsRepeatables(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	metrics := &recordedMetrics{}
+	SetMetrics(metrics)
+	defer SetMetrics(nil)
+
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n")},
+		"migrations/R_view.sql":   {Data: []byte("-- +up\nCREATE VIEW one_view AS SELECT id FROM one;\n")},
+		"migrations/R_zbad.sql":   {Data: []byte("-- +up\nCREATE VIEW;\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err == nil {
+		t.Fatalf("Expected the broken repeatable migration to fail")
+	}
+	if !reflect.DeepEqual(metrics.operations, []string{"up ok", "repeatable ok", "repeatable failed"}) {
+		t.Fatalf("Unexpected operations %v", metrics.operations)
+	}
+
+	// Repeatable migrations are recorded in the history with version 0
+	entries, err := History(db)
+	if err != nil {
+		t.Fatalf("History failed: %s", err)
+	}
+	if len(entries) != 3 || entries[1].Operation != HistoryRepeatable || entries[1].Version != 0 ||
+		!entries[1].Success || entries[2].Success {
+		t.Fatalf("Unexpected history entries: %+v", entries)
+	}
+}
@@ -0,0 +1,89 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"time"
+)
+
+// DownSource selects where MigrateDown reads the down SQL of a migration from.
+type DownSource int
+
+const (
+	// PreferStoredDown uses the down SQL stored when the migration was applied.
+	// The migration file is used for migrations applied before down SQL was stored.
+	PreferStoredDown DownSource = iota
+
+	// PreferFileDown uses the down section of the migration file.
+	// The stored down SQL is used when the migration file no longer exists.
+	PreferFileDown
+)
+
+// SetDownSource sets where the down SQL is read from when reverting a migration.
+// Defaults to PreferStoredDown.
+func SetDownSource(source DownSource) {
+	activeDownSource = source
+}
+
+// SetHistoryActor sets the actor recorded in the migration history,
+// such as a deploy pipeline or user name.
+// Defaults to user@host of the current process.
+func SetHistoryActor(actor string) {
+	activeHistoryActor = actor
+}
+
+// SetAllowOutOfOrder sets whether unapplied migrations with a version lower than
+// the installed version are applied, such as after merging branches.
+// When false, migrating up fails with ErrOutOfOrder instead. Defaults to false.
+func SetAllowOutOfOrder(allow bool) {
+	activeAllowOutOfOrder = allow
+}
+
+// SetLockTimeout sets how long migrating waits for the migration lock
+// held by another migrator before failing. Defaults to 10 minutes.
+func SetLockTimeout(timeout time.Duration) {
+	activeLockTimeout = timeout
+}
+
+// SetAtomicBatch sets whether migrating up applies all pending migrations and their bookkeeping
+// in a single transaction, so a failing migration leaves none of them applied.
+// Requires a dialect with TransactionalDDL, migrating up fails with ErrAtomicBatchUnsupported otherwise.
+// Defaults to false, committing after each migration.
+func SetAtomicBatch(atomic bool) {
+	activeAtomicBatch = atomic
+}
+
+// SetSessionSetup sets statements run at the start of each migration transaction,
+// such as SET LOCAL lock_timeout or SET ROLE. Files override them with `-- +session` directives.
+// Defaults to none.
+func SetSessionSetup(statements ...string) {
+	activeSessionSetup = statements
+}
+
+// SetTxOptions sets the options of each migration transaction, such as the isolation level.
+// Files override the isolation level with an `-- +isolation` directive.
+// Defaults to nil, using the defaults of the driver.
+func SetTxOptions(opts *sql.TxOptions) {
+	activeTxOptions = opts
+}
+
+// SetRetryPolicy sets how migration transactions failing on transient errors,
+// such as deadlocks and lock timeouts, are retried. Each attempt is logged.
+// Defaults to no retries.
+func SetRetryPolicy(policy RetryPolicy) {
+	activeRetryPolicy = policy
+}
+
+// SetDataMigrationOptions sets the batch size, pause between batches and progress reporting
+// of batched data migrations, marked with a `-- +batch` directive.
+func SetDataMigrationOptions(opts DataMigrationOptions) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	activeDataMigrationOptions = opts
+}
+
+// SetMetrics sets the metrics receiving migration outcomes, durations, lock wait times
+// and versions, nil to disable metrics. Defaults to nil.
+func SetMetrics(metrics Metrics) {
+	activeMetrics = metrics
+}
@@ -0,0 +1,227 @@
+// Package pgxexecutor runs dbmigrator migrations on pgx v5 connections and pools
+// without opening a database/sql pool.
+//
+//	pool, err := pgxpool.New(ctx, connString)
+//	...
+//	err = dbmigrator.MigrateUpWith(pgxexecutor.FromPool(pool), migrationFS, "migrations")
+package pgxexecutor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/NotCoffee418/dbmigrator"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// driverName is reported for dialect detection and detects the PostgreSQL query set
+const driverName = "github.com/jackc/pgx/v5"
+
+// FromPool adapts a pgx connection pool.
+func FromPool(pool *pgxpool.Pool) dbmigrator.Executor {
+	return poolExecutor{pool}
+}
+
+// FromConn adapts a single pgx connection, which stays open after migrating.
+func FromConn(conn *pgx.Conn) dbmigrator.Executor {
+	return connExecutor{conn}
+}
+
+// FromTx runs all migrations and bookkeeping in a caller's pgx transaction,
+// with a savepoint per migration. The caller commits or rolls back tx afterwards.
+func FromTx(tx pgx.Tx) dbmigrator.Executor {
+	return dbmigrator.TxExecutor(pgxTx{tx}, driverName)
+}
+
+// querier is implemented by pgx connections, pools and transactions
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func exec(q querier, query string, args []any) (sql.Result, error) {
+	tag, err := q.Exec(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result(tag), nil
+}
+
+func query(q querier, query string, args []any) (dbmigrator.Rows, error) {
+	rows, err := q.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgxRows{rows}, nil
+}
+
+type poolExecutor struct {
+	pool *pgxpool.Pool
+}
+
+func (e poolExecutor) Exec(query string, args ...any) (sql.Result, error) {
+	return exec(e.pool, query, args)
+}
+
+func (e poolExecutor) Query(q string, args ...any) (dbmigrator.Rows, error) {
+	return query(e.pool, q, args)
+}
+
+func (e poolExecutor) QueryRow(query string, args ...any) dbmigrator.Row {
+	return e.pool.QueryRow(context.Background(), query, args...)
+}
+
+func (e poolExecutor) Begin(opts *sql.TxOptions) (dbmigrator.Tx, error) {
+	txOptions, err := pgxTxOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := e.pool.BeginTx(context.Background(), txOptions)
+	if err != nil {
+		return nil, err
+	}
+	return pgxTx{tx}, nil
+}
+
+func (e poolExecutor) Session() (dbmigrator.Executor, func() error, error) {
+	conn, err := e.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	release := func() error {
+		conn.Release()
+		return nil
+	}
+	return connExecutor{conn.Conn()}, release, nil
+}
+
+func (e poolExecutor) DriverName() string {
+	return driverName
+}
+
+type connExecutor struct {
+	conn *pgx.Conn
+}
+
+func (e connExecutor) Exec(query string, args ...any) (sql.Result, error) {
+	return exec(e.conn, query, args)
+}
+
+func (e connExecutor) Query(q string, args ...any) (dbmigrator.Rows, error) {
+	return query(e.conn, q, args)
+}
+
+func (e connExecutor) QueryRow(query string, args ...any) dbmigrator.Row {
+	return e.conn.QueryRow(context.Background(), query, args...)
+}
+
+func (e connExecutor) Begin(opts *sql.TxOptions) (dbmigrator.Tx, error) {
+	txOptions, err := pgxTxOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := e.conn.BeginTx(context.Background(), txOptions)
+	if err != nil {
+		return nil, err
+	}
+	return pgxTx{tx}, nil
+}
+
+func (e connExecutor) Session() (dbmigrator.Executor, func() error, error) {
+	return e, func() error { return nil }, nil
+}
+
+func (e connExecutor) DriverName() string {
+	return driverName
+}
+
+// pgxTxOptions converts database/sql transaction options to pgx transaction options
+func pgxTxOptions(opts *sql.TxOptions) (pgx.TxOptions, error) {
+	var txOptions pgx.TxOptions
+	if opts == nil {
+		return txOptions, nil
+	}
+	switch opts.Isolation {
+	case sql.LevelDefault:
+	case sql.LevelReadUncommitted:
+		txOptions.IsoLevel = pgx.ReadUncommitted
+	case sql.LevelReadCommitted:
+		txOptions.IsoLevel = pgx.ReadCommitted
+	case sql.LevelRepeatableRead:
+		txOptions.IsoLevel = pgx.RepeatableRead
+	case sql.LevelSerializable:
+		txOptions.IsoLevel = pgx.Serializable
+	default:
+		return txOptions, fmt.Errorf("isolation level %s is not supported by PostgreSQL", opts.Isolation)
+	}
+	if opts.ReadOnly {
+		txOptions.AccessMode = pgx.ReadOnly
+	}
+	return txOptions, nil
+}
+
+type pgxTx struct {
+	tx pgx.Tx
+}
+
+func (t pgxTx) Exec(query string, args ...any) (sql.Result, error) {
+	return exec(t.tx, query, args)
+}
+
+func (t pgxTx) Query(q string, args ...any) (dbmigrator.Rows, error) {
+	return query(t.tx, q, args)
+}
+
+func (t pgxTx) QueryRow(query string, args ...any) dbmigrator.Row {
+	return t.tx.QueryRow(context.Background(), query, args...)
+}
+
+func (t pgxTx) Commit() error {
+	return t.tx.Commit(context.Background())
+}
+
+func (t pgxTx) Rollback() error {
+	return t.tx.Rollback(context.Background())
+}
+
+// ExecBatch sends the statements of a migration in one round trip
+// and reports which statement failed.
+func (t pgxTx) ExecBatch(statements []string) error {
+	batch := &pgx.Batch{}
+	for _, statement := range statements {
+		batch.Queue(statement)
+	}
+	results := t.tx.SendBatch(context.Background(), batch)
+	for i, statement := range statements {
+		if _, err := results.Exec(); err != nil {
+			_ = results.Close()
+			return fmt.Errorf("statement %d (%s): %w", i+1, statement, err)
+		}
+	}
+	return results.Close()
+}
+
+type pgxRows struct {
+	pgx.Rows
+}
+
+func (r pgxRows) Close() error {
+	r.Rows.Close()
+	return nil
+}
+
+// result adapts a pgx command tag to sql.Result
+type result pgconn.CommandTag
+
+func (r result) LastInsertId() (int64, error) {
+	return 0, errors.New("LastInsertId is not supported by PostgreSQL")
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return pgconn.CommandTag(r).RowsAffected(), nil
+}
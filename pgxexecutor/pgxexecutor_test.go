@@ -0,0 +1,91 @@
+package pgxexecutor
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/NotCoffee418/dbmigrator"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// connString is the PostgreSQL service of docker-compose.integration-tests.yaml
+const connString = "host=localhost port=10000 user=test password=test dbname=test sslmode=disable"
+
+func TestMigrationsOnPool(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pool, err := pgxpool.New(ctx, connString)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %s", err)
+	}
+	defer pool.Close()
+	if err := pool.Ping(ctx); err != nil {
+		t.Skipf("PostgreSQL is not running, start docker-compose.integration-tests.yaml: %s", err)
+	}
+
+	executor := FromPool(pool)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE pgx_one (id INT);\nINSERT INTO pgx_one VALUES (1);\n-- +down\nDROP TABLE pgx_one;\n")},
+		"migrations/0002_two.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE pgx_two (id INT);\n-- +down\nDROP TABLE pgx_two;\n")},
+	}
+	if err := dbmigrator.FreshWith(executor, migrationFs, "migrations", true); err != nil {
+		t.Fatalf("FreshWith failed: %s", err)
+	}
+	status, err := dbmigrator.StatusWith(executor, migrationFs, "migrations")
+	if err != nil || status.InstalledVersion != 2 {
+		t.Fatalf("Expected version 2, got %+v, %v", status, err)
+	}
+	if err := dbmigrator.MigrateDownWith(executor, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateDownWith failed: %s", err)
+	}
+
+	// A failing statement in a batch is reported
+	migrationFs["migrations/0002_two.sql"] = &fstest.MapFile{Data: []byte(
+		"-- +up\nCREATE TABLE pgx_two (id INT);\nSELECT missing FROM pgx_two;\n-- +down\nDROP TABLE pgx_two;\n")}
+	err = dbmigrator.MigrateUpWith(executor, migrationFs, "migrations")
+	if err == nil {
+		t.Fatalf("Expected the failing migration to return an error")
+	}
+	status, err = dbmigrator.StatusWith(executor, migrationFs, "migrations")
+	if err != nil || status.InstalledVersion != 1 {
+		t.Fatalf("Expected the failed migration to be rolled back, got %+v, %v", status, err)
+	}
+}
+
+func TestMigrationsInTransaction(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pool, err := pgxpool.New(ctx, connString)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %s", err)
+	}
+	defer pool.Close()
+	if err := pool.Ping(ctx); err != nil {
+		t.Skipf("PostgreSQL is not running, start docker-compose.integration-tests.yaml: %s", err)
+	}
+
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %s", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte("-- +up\nCREATE TABLE pgx_tx_one (id INT);\n-- +down\nDROP TABLE pgx_tx_one;\n")},
+		"migrations/0002_two.sql": {Data: []byte("-- +up\nSELECT missing FROM pgx_tx_one;\n-- +down\n")},
+	}
+	executor := FromTx(tx)
+	if err := dbmigrator.MigrateUpWith(executor, migrationFs, "migrations"); err == nil {
+		t.Fatalf("Expected the second migration to fail")
+	}
+
+	// The failed migration rolled back to its savepoint without aborting the transaction
+	status, err := dbmigrator.StatusWith(executor, migrationFs, "migrations")
+	if err != nil || status.InstalledVersion != 1 {
+		t.Fatalf("Expected version 1 in the transaction, got %+v, %v", status, err)
+	}
+}
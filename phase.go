@@ -0,0 +1,193 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// Phase selects the sections of migrations applied for expand/contract deployments.
+type Phase string
+
+const (
+	// PhaseAll applies every section, the pre phase followed by the post phase.
+	PhaseAll Phase = ""
+
+	// PhasePre applies `-- +up pre` sections before new code rolls out, such as adding a column.
+	// Migrations without phase markers are applied completely in the pre phase.
+	PhasePre Phase = "pre"
+
+	// PhasePost applies `-- +up post` sections after new code rolled out, such as dropping a column,
+	// and records the migrations as applied.
+	PhasePost Phase = "post"
+)
+
+// ParsePhase parses a phase name, pre, post or all.
+func ParsePhase(name string) (Phase, error) {
+	switch name {
+	case "", "all":
+		return PhaseAll, nil
+	case "pre":
+		return PhasePre, nil
+	case "post":
+		return PhasePost, nil
+	}
+	return PhaseAll, fmt.Errorf("unknown phase %q, expected pre, post or all", name)
+}
+
+// MigrateUpPhase migrates the database up applying only the sections of a phase.
+// Migrations whose pre phase was applied are recorded as applied once their post phase ran.
+// Requires a dialect supporting phases when files contain phase markers.
+func MigrateUpPhase(db *sql.DB, migrationFs fs.FS, migrationDir string, phase Phase) error {
+	return MigrateUpPhaseWith(SQLExecutor(db), migrationFs, migrationDir, phase)
+}
+
+// MigrateUpPhaseWith works like MigrateUpPhase with queries run by an Executor.
+func MigrateUpPhaseWith(db Executor, migrationFs fs.FS, migrationDir string, phase Phase) error {
+	return withMigrationLock(db, func(db *queryExecutor) error {
+		return migrateUpTo(db, migrationFs, migrationDir, 0, phase)
+	})
+}
+
+// PlanUpPhase returns the migrations MigrateUpPhase would apply for a phase.
+// It only reads the database, a database without migrations table has every migration pending.
+func PlanUpPhase(db *sql.DB, migrationFs fs.FS, migrationDir string, phase Phase) (MigrationPlan, error) {
+	return PlanUpPhaseWith(SQLExecutor(db), migrationFs, migrationDir, phase)
+}
+
+// PlanUpPhaseWith works like PlanUpPhase with queries run by an Executor.
+func PlanUpPhaseWith(db Executor, migrationFs fs.FS, migrationDir string, phase Phase) (MigrationPlan, error) {
+	bound, err := withQueries(db)
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+	migrationState, err := loadMigrationState(bound, migrationFs, migrationDir, false)
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+	migrations, repeatables, err := planUp(bound, migrationFs, migrationState, 0)
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+
+	plan := newUpPlan(migrationState, repeatables)
+	plan.Phase = phase
+	for i := range migrations {
+		migration := &migrations[i]
+		if err := loadMigrationContents(migrationFs, migration); err != nil {
+			return MigrationPlan{}, err
+		}
+		step, err := planPhaseStep(migration, phase)
+		if err != nil {
+			return MigrationPlan{}, err
+		}
+		if step == nil {
+			continue
+		}
+		plan.Versions = append(plan.Versions, migration.version)
+		if !step.prePhase && migration.version > plan.ToVersion {
+			plan.ToVersion = migration.version
+		}
+	}
+	return plan, nil
+}
+
+// phaseStep is the part of a migration applied in a phase
+type phaseStep struct {
+	script   string
+	prePhase bool // records the pre phase instead of the migration
+}
+
+// history returns the history operation and checksum of the SQL the step runs
+func (step *phaseStep) history() (HistoryOperation, string) {
+	if step.prePhase {
+		return HistoryUpPre, checksum(step.script)
+	}
+	return HistoryUp, checksum(step.script)
+}
+
+// hasPostPhase reports whether a migration has a `-- +up post` section
+func hasPostPhase(contents *migrationContents) bool {
+	return contents.phased && contents.hasUpPost
+}
+
+// planPhaseStep returns the part of a migration to apply in a phase, nil when there is nothing to apply
+func planPhaseStep(migration *migrationFileInfo, phase Phase) (*phaseStep, error) {
+	contents := migration.contents
+	switch phase {
+	case PhasePre:
+		if !hasPostPhase(contents) {
+			return &phaseStep{script: contents.up}, nil
+		}
+		if migration.prePhaseApplied {
+			return nil, nil
+		}
+		return &phaseStep{script: contents.upPre, prePhase: true}, nil
+
+	case PhasePost:
+		if !hasPostPhase(contents) {
+			return nil, fmt.Errorf("migration %d has no `-- +up post` section, apply it with the pre phase first",
+				migration.version)
+		}
+		if contents.hasUpPre && !migration.prePhaseApplied {
+			return nil, fmt.Errorf("the pre phase of migration %d has not been applied", migration.version)
+		}
+		return &phaseStep{script: contents.upPost}, nil
+
+	default:
+		if migration.prePhaseApplied {
+			return &phaseStep{script: contents.upPost}, nil
+		}
+		return &phaseStep{script: contents.up}, nil
+	}
+}
+
+// recordPrePhase records that the pre phase of a migration was applied
+func recordPrePhase(queries *MigrationQueryDefinition, tx Tx, migration *migrationFileInfo) error {
+	if queries.InsertPhase == "" {
+		return fmt.Errorf("migration %d has phases, which the dialect does not support", migration.version)
+	}
+	if _, err := tx.Exec(queries.InsertPhase, migration.version, string(PhasePre), time.Now()); err != nil {
+		return fmt.Errorf("error recording pre phase of migration %d: %w", migration.version, err)
+	}
+	return nil
+}
+
+// deletePhases removes the recorded phases of a migration once it is applied
+func deletePhases(queries *MigrationQueryDefinition, tx Tx, version int) error {
+	if queries.DeletePhases == "" {
+		return nil
+	}
+	if _, err := tx.Exec(queries.DeletePhases, version); err != nil {
+		return fmt.Errorf("error removing recorded phases of migration %d: %w", version, err)
+	}
+	return nil
+}
+
+// getPrePhaseVersions returns the versions whose pre phase was applied, awaiting their post phase
+func getPrePhaseVersions(db *queryExecutor) ([]int, error) {
+	if db.queries.SelectPhases == "" {
+		return nil, nil
+	}
+	rows, err := db.Query(db.queries.SelectPhases)
+	if err != nil {
+		return nil, fmt.Errorf("error getting migration phases: %w", err)
+	}
+	defer rows.Close()
+	var versions []int
+	for rows.Next() {
+		var version int
+		var phase string
+		if err := rows.Scan(&version, &phase); err != nil {
+			return nil, fmt.Errorf("error getting migration phases: %w", err)
+		}
+		if Phase(phase) == PhasePre {
+			versions = append(versions, version)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting migration phases: %w", err)
+	}
+	return versions, nil
+}
@@ -0,0 +1,155 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// phasedMigrations renames users.legacy to users.full_name in an expand/contract migration
+// between two plain migrations
+func phasedMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"migrations/0001_users.sql": {Data: []byte("-- +up\nCREATE TABLE users (id INT PRIMARY KEY, legacy TEXT);\n" +
+			"-- +down\nDROP TABLE users;\n")},
+		"migrations/0002_full_name.sql": {Data: []byte("-- +up pre\nALTER TABLE users ADD COLUMN full_name TEXT;\n" +
+			"-- +up post\nALTER TABLE users DROP COLUMN legacy;\n" +
+			"-- +down\nALTER TABLE users ADD COLUMN legacy TEXT;\nALTER TABLE users DROP COLUMN full_name;\n")},
+		"migrations/0003_orders.sql": {Data: []byte("-- +up\nCREATE TABLE orders (id INT PRIMARY KEY);\n" +
+			"-- +down\nDROP TABLE orders;\n")},
+	}
+}
+
+// columnExists reports whether a SQLite table has a column
+func columnExists(t *testing.T, db *sql.DB, table string, column string) bool {
+	t.Helper()
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to check column %s.%s: %s", table, column, err)
+	}
+	return count > 0
+}
+
+func TestMigrateUpPhases(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := phasedMigrations()
+
+	// The pre phase applies plain migrations and the pre section of phased migrations
+	for i := 0; i < 2; i++ {
+		if err := MigrateUpPhase(db, migrationFs, "migrations", PhasePre); err != nil {
+			t.Fatalf("MigrateUpPhase pre failed: %s", err)
+		}
+	}
+	if !columnExists(t, db, "users", "full_name") || !columnExists(t, db, "users", "legacy") || !tableExists(t, db, "orders") {
+		t.Fatalf("Expected the pre phase to add full_name and keep legacy")
+	}
+	status, err := Status(db, migrationFs, "migrations")
+	if err != nil {
+		t.Fatalf("Status failed: %s", err)
+	}
+	if !reflect.DeepEqual(status.AppliedVersions, []int{1, 3}) || !reflect.DeepEqual(status.PrePhaseVersions, []int{2}) ||
+		!reflect.DeepEqual(status.PendingVersions, []int{2}) || len(status.OutOfOrderVersions) != 0 {
+		t.Fatalf("Unexpected status after the pre phase: %+v", status)
+	}
+	plan, err := PlanUpPhase(db, migrationFs, "migrations", PhasePost)
+	if err != nil || !reflect.DeepEqual(plan.Versions, []int{2}) || plan.Phase != PhasePost {
+		t.Fatalf("Unexpected post phase plan %+v (%v)", plan, err)
+	}
+
+	// The post phase runs the post section and records the migration
+	if err := MigrateUpPhase(db, migrationFs, "migrations", PhasePost); err != nil {
+		t.Fatalf("MigrateUpPhase post failed: %s", err)
+	}
+	if columnExists(t, db, "users", "legacy") {
+		t.Fatalf("Expected the post phase to drop legacy")
+	}
+	status, err = Status(db, migrationFs, "migrations")
+	if err != nil {
+		t.Fatalf("Status failed: %s", err)
+	}
+	if !reflect.DeepEqual(status.AppliedVersions, []int{1, 2, 3}) || len(status.PrePhaseVersions) != 0 {
+		t.Fatalf("Unexpected status after the post phase: %+v", status)
+	}
+
+	entries, err := History(db)
+	if err != nil {
+		t.Fatalf("History failed: %s", err)
+	}
+	var operations []HistoryOperation
+	for _, entry := range entries {
+		if entry.Version == 2 {
+			operations = append(operations, entry.Operation)
+		}
+	}
+	if !reflect.DeepEqual(operations, []HistoryOperation{HistoryUpPre, HistoryUp}) {
+		t.Fatalf("Unexpected history of migration 2: %v", operations)
+	}
+}
+
+func TestMigrateUpAfterPrePhase(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := phasedMigrations()
+
+	// The post phase requires the pre phase
+	if err := MigrateUpPhase(db, migrationFs, "migrations", PhasePost); err == nil {
+		t.Fatalf("Expected the post phase to fail before the pre phase")
+	}
+	if err := MigrateUpPhase(db, migrationFs, "migrations", PhasePre); err != nil {
+		t.Fatalf("MigrateUpPhase pre failed: %s", err)
+	}
+
+	// Migrating up without a phase only runs the remaining post section
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+	if !columnExists(t, db, "users", "full_name") || columnExists(t, db, "users", "legacy") {
+		t.Fatalf("Expected full_name without legacy")
+	}
+	version, err := getInstalledMigrationVersion(bindTestQueries(t, SQLExecutor(db)))
+	if err != nil || version != 3 {
+		t.Fatalf("Expected version 3, got %d (%v)", version, err)
+	}
+}
+
+func TestPhaseSections(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		contents string
+		valid    bool
+	}{
+		{"pre and post", "-- +up pre\nSELECT 1;\n-- +up post\nSELECT 2;\n", true},
+		{"post only", "-- +up post\nSELECT 2;\n", true},
+		{"mixed", "-- +up\nSELECT 1;\n-- +up post\nSELECT 2;\n", false},
+		{"duplicate", "-- +up pre\nSELECT 1;\n-- +up pre\nSELECT 2;\n", false},
+		{"batched", "-- +batch\n-- +up pre\nSELECT 1;\n-- +up post\nSELECT 2;\n", false},
+	} {
+		migration := &migrationFileInfo{version: 1, file: "0001_test.sql"}
+		err := loadMigrationContents(fstest.MapFS{"0001_test.sql": {Data: []byte(test.contents)}}, migration)
+		if (err == nil) != test.valid {
+			t.Fatalf("%s: unexpected result %v", test.name, err)
+		}
+	}
+
+	migration := &migrationFileInfo{version: 1, file: "0001_test.sql"}
+	err := loadMigrationContents(fstest.MapFS{"0001_test.sql": {Data: []byte("-- +up pre\nSELECT 1;\n-- +up post\nSELECT 2;\n")}}, migration)
+	if err != nil || migration.contents.up != "SELECT 1;\nSELECT 2;\n" {
+		t.Fatalf("Expected the up section to run both phases, got %q (%v)", migration.contents.up, err)
+	}
+}
+
+func TestPhaseFlag(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	env := commandEnv{db: db, migrationFS: phasedMigrations(), migrationDir: "migrations"}
+	if err := findMigrateCommand("up").execute(env, []string{"--phase", "later"}); !errors.Is(err, ErrUsage) {
+		t.Fatalf("Expected ErrUsage for an unknown phase, got %v", err)
+	}
+	if err := findMigrateCommand("up").execute(env, []string{"--phase=pre"}); err != nil {
+		t.Fatalf("migrate up --phase=pre failed: %s", err)
+	}
+	if !columnExists(t, db, "users", "legacy") {
+		t.Fatalf("Expected migrate up --phase=pre to keep legacy")
+	}
+}
@@ -0,0 +1,231 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MigrationPlan lists the migrations an operation would run, without running them.
+// It is emitted as JSON by `migrate plan --format json`, field names are stable.
+type MigrationPlan struct {
+	Direction   HistoryOperation `json:"direction"`       // HistoryUp or HistoryDown
+	FromVersion int              `json:"from_version"`    // Installed version before the operation
+	ToVersion   int              `json:"to_version"`      // Installed version after the operation
+	Versions    []int            `json:"versions"`        // Versioned migrations in execution order
+	Repeatables []string         `json:"repeatables"`     // Repeatable migrations applied after the versioned migrations
+	Phase       Phase            `json:"phase,omitempty"` // Phase of an up plan, empty for all phases
+}
+
+// PlanUp returns the migrations MigrateUpTo would apply for the target version.
+// A target of 0 plans up to the latest version.
+// It only reads the database, a database without migrations table has every migration pending.
+func PlanUp(db *sql.DB, migrationFs fs.FS, migrationDir string, target int) (MigrationPlan, error) {
+	return PlanUpWith(SQLExecutor(db), migrationFs, migrationDir, target)
+}
+
+// PlanUpWith works like PlanUp with queries run by an Executor.
+func PlanUpWith(db Executor, migrationFs fs.FS, migrationDir string, target int) (MigrationPlan, error) {
+	bound, err := withQueries(db)
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+	migrationState, err := loadMigrationState(bound, migrationFs, migrationDir, false)
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+	migrations, repeatables, err := planUp(bound, migrationFs, migrationState, target)
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+
+	plan := newUpPlan(migrationState, repeatables)
+	for _, migration := range migrations {
+		plan.Versions = append(plan.Versions, migration.version)
+		if migration.version > plan.ToVersion {
+			plan.ToVersion = migration.version
+		}
+	}
+	return plan, nil
+}
+
+// newUpPlan returns an up plan from the installed version applying repeatables, without versioned migrations
+func newUpPlan(migrationState MigrationState, repeatables []migrationFileInfo) MigrationPlan {
+	plan := MigrationPlan{
+		Direction:   HistoryUp,
+		FromVersion: migrationState.InstalledVersion,
+		ToVersion:   migrationState.InstalledVersion,
+		Versions:    []int{},
+		Repeatables: []string{},
+	}
+	for _, repeatable := range repeatables {
+		plan.Repeatables = append(plan.Repeatables, repeatable.name)
+	}
+	return plan
+}
+
+// PlanDown returns the migrations MigrateDownTo would revert for the target version.
+// A negative target plans reverting only the installed migration like MigrateDown.
+// It only reads the database.
+func PlanDown(db *sql.DB, migrationFs fs.FS, migrationDir string, target int) (MigrationPlan, error) {
+	return PlanDownWith(SQLExecutor(db), migrationFs, migrationDir, target)
+}
+
+// PlanDownWith works like PlanDown with queries run by an Executor.
+func PlanDownWith(db Executor, migrationFs fs.FS, migrationDir string, target int) (MigrationPlan, error) {
+	bound, err := withQueries(db)
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+	migrationState, err := loadMigrationState(bound, migrationFs, migrationDir, false)
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+	versions, err := planDown(migrationState, target)
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+
+	plan := MigrationPlan{
+		Direction:   HistoryDown,
+		FromVersion: migrationState.InstalledVersion,
+		Versions:    append([]int{}, versions...),
+		Repeatables: []string{},
+	}
+	for _, version := range migrationState.AppliedVersions {
+		if !containsVersion(versions, version) && version > plan.ToVersion {
+			plan.ToVersion = version
+		}
+	}
+	return plan, nil
+}
+
+// String formats the plan for display on the command line
+func (p MigrationPlan) String() string {
+	var b strings.Builder
+	if p.Phase != PhaseAll {
+		fmt.Fprintf(&b, "Migrate %s (%s phase) from version %d to version %d\n",
+			p.Direction, p.Phase, p.FromVersion, p.ToVersion)
+	} else {
+		fmt.Fprintf(&b, "Migrate %s from version %d to version %d\n", p.Direction, p.FromVersion, p.ToVersion)
+	}
+	if len(p.Versions) == 0 && len(p.Repeatables) == 0 {
+		b.WriteString("Nothing to do.\n")
+	}
+	for _, version := range p.Versions {
+		fmt.Fprintf(&b, "  %s %04d\n", p.Direction, version)
+	}
+	for _, name := range p.Repeatables {
+		fmt.Fprintf(&b, "  repeatable %s\n", name)
+	}
+	return b.String()
+}
+
+// MigrateDownTo reverts every applied migration above the target version, newest first.
+// Returns ErrIrreversible when reaching a migration that can not be reverted.
+func MigrateDownTo(db *sql.DB, migrationFs fs.FS, migrationDir string, target int) error {
+	return MigrateDownToWith(SQLExecutor(db), migrationFs, migrationDir, target)
+}
+
+// MigrateDownToWith works like MigrateDownTo with queries run by an Executor.
+func MigrateDownToWith(db Executor, migrationFs fs.FS, migrationDir string, target int) error {
+	if target < 0 {
+		return fmt.Errorf("invalid target version %d", target)
+	}
+	return withMigrationLock(db, func(db *queryExecutor) error {
+		for {
+			installedVersion, err := getInstalledMigrationVersion(db)
+			if err != nil {
+				return err
+			}
+			if installedVersion <= target {
+				return nil
+			}
+			if err := migrateDown(db, migrationFs, migrationDir); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// planUp returns the versioned and repeatable migrations to apply to reach the target version,
+// with their contents loaded. A target of 0 plans up to the latest version.
+func planUp(db *queryExecutor, migrationFs fs.FS, migrationState MigrationState, target int) ([]migrationFileInfo, []migrationFileInfo, error) {
+	if migrationState.InstalledVersion > migrationState.AvailableVersion {
+		return nil, nil, fmt.Errorf(
+			"installed migration version (%d) is higher than highest available migration (%d)",
+			migrationState.InstalledVersion, migrationState.AvailableVersion)
+	}
+	if target != 0 && !migrationExists(migrationState.Migrations, target) {
+		return nil, nil, fmt.Errorf("migration %d does not exist", target)
+	}
+
+	// Repeatable migrations that changed since they were applied
+	repeatablesToApply, err := pendingRepeatables(db, migrationFs, migrationState.Repeatables)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Find migrations that have not been applied yet
+	pending, outOfOrderVersions := pendingMigrations(migrationState)
+	if len(outOfOrderVersions) > 0 {
+		if !activeAllowOutOfOrder {
+			return nil, nil, fmt.Errorf("%w: versions %s are lower than installed version %d",
+				ErrOutOfOrder, formatVersions(outOfOrderVersions), migrationState.InstalledVersion)
+		}
+		log.Warnf("Applying out of order migrations %s below installed version %d",
+			formatVersions(outOfOrderVersions), migrationState.InstalledVersion)
+	}
+	var migrationsToApply []migrationFileInfo
+	for _, migration := range pending {
+		if target == 0 || migration.version <= target {
+			migrationsToApply = append(migrationsToApply, migration)
+		}
+	}
+	return migrationsToApply, repeatablesToApply, nil
+}
+
+// planDown returns the applied versions to revert to reach the target version, newest first.
+// A negative target plans reverting only the installed migration.
+func planDown(migrationState MigrationState, target int) ([]int, error) {
+	if migrationState.InstalledVersion == 0 {
+		return nil, errors.New("no migrations to revert")
+	}
+	if target < 0 {
+		return []int{migrationState.InstalledVersion}, nil
+	}
+
+	var versions []int
+	for _, version := range migrationState.AppliedVersions {
+		if version > target {
+			versions = append(versions, version)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	return versions, nil
+}
+
+// migrationExists reports whether a versioned migration with the version is available
+func migrationExists(migrations []migrationFileInfo, version int) bool {
+	for _, migration := range migrations {
+		if migration.version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// containsVersion reports whether versions contains version
+func containsVersion(versions []int, version int) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
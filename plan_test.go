@@ -0,0 +1,138 @@
+package dbmigrator
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPlanAndTargetVersions(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_two.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE two (id INT);\n-- +down\nDROP TABLE two;\n")},
+		"migrations/0003_three.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE three (id INT);\n-- +down\nDROP TABLE three;\n")},
+	}
+	if err := ensureMigrationTableExists(bindTestQueries(t, SQLExecutor(db))); err != nil {
+		t.Fatalf("ensureMigrationTableExists failed: %s", err)
+	}
+
+	// Planning does not touch the database
+	plan, err := PlanUp(db, migrationFs, "migrations", 2)
+	if err != nil {
+		t.Fatalf("PlanUp failed: %s", err)
+	}
+	if !reflect.DeepEqual(plan.Versions, []int{1, 2}) || plan.ToVersion != 2 {
+		t.Fatalf("Expected plan of versions 1 and 2, got %+v", plan)
+	}
+	if tableExists(t, db, "one") {
+		t.Fatalf("Expected PlanUp not to apply migrations")
+	}
+
+	// Migrate up to a target version
+	if err := MigrateUpTo(db, migrationFs, "migrations", 2); err != nil {
+		t.Fatalf("MigrateUpTo failed: %s", err)
+	}
+	if !tableExists(t, db, "two") || tableExists(t, db, "three") {
+		t.Fatalf("Expected migrations up to version 2 to be applied")
+	}
+	if _, err := PlanUp(db, migrationFs, "migrations", 4); err == nil {
+		t.Fatalf("Expected planning up to a missing version to fail")
+	}
+
+	// Migrate down to a target version
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+	plan, err = PlanDown(db, migrationFs, "migrations", 1)
+	if err != nil {
+		t.Fatalf("PlanDown failed: %s", err)
+	}
+	if !reflect.DeepEqual(plan.Versions, []int{3, 2}) || plan.ToVersion != 1 {
+		t.Fatalf("Expected plan reverting versions 3 and 2, got %+v", plan)
+	}
+	if err := MigrateDownTo(db, migrationFs, "migrations", 1); err != nil {
+		t.Fatalf("MigrateDownTo failed: %s", err)
+	}
+	if !tableExists(t, db, "one") || tableExists(t, db, "two") {
+		t.Fatalf("Expected migrations above version 1 to be reverted")
+	}
+}
+
+func TestHandleMigratorCommandUsage(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+	}
+
+	if handled, err := HandleMigratorCommand(db, migrationFs, "migrations", "serve"); handled || err != nil {
+		t.Fatalf("Expected other commands not to be handled, got %v, %v", handled, err)
+	}
+	handled, err := HandleMigratorCommand(db, migrationFs, "migrations", "migrate", "sideways")
+	if !handled || !errors.Is(err, ErrUsage) {
+		t.Fatalf("Expected ErrUsage for an unknown command, got %v, %v", handled, err)
+	}
+	_, err = HandleMigratorCommand(db, migrationFs, "migrations", "migrate", "up", "--bogus")
+	if !errors.Is(err, ErrUsage) {
+		t.Fatalf("Expected ErrUsage for an unknown flag, got %v", err)
+	}
+	_, err = HandleMigratorCommand(db, migrationFs, "migrations", "migrate", "baseline")
+	if !errors.Is(err, ErrUsage) {
+		t.Fatalf("Expected ErrUsage for a missing argument, got %v", err)
+	}
+
+	// Dry runs leave the database untouched, flags may follow arguments
+	if _, err := HandleMigratorCommand(db, migrationFs, "migrations", "migrate", "up", "--dry-run"); err != nil {
+		t.Fatalf("Dry run failed: %s", err)
+	}
+	if tableExists(t, db, "one") {
+		t.Fatalf("Expected dry run not to apply migrations")
+	}
+	if _, err := HandleMigratorCommand(db, migrationFs, "migrations", "migrate", "up", "--to", "1"); err != nil {
+		t.Fatalf("migrate up failed: %s", err)
+	}
+	if !tableExists(t, db, "one") {
+		t.Fatalf("Expected migrate up to apply migrations")
+	}
+}
+
+func TestPlanOnEmptyDatabaseCreatesNoTables(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_two.sql": {Data: []byte("-- +up pre\nCREATE TABLE two (id INT);\n-- +up post\nSELECT 1;\n")},
+		"migrations/R_view.sql":   {Data: []byte("-- +up\nCREATE VIEW one_view AS SELECT id FROM one;\n")},
+	}
+
+	// Dry runs of up, up --phase and down
+	plan, err := PlanUp(db, migrationFs, "migrations", 0)
+	if err != nil {
+		t.Fatalf("PlanUp failed: %s", err)
+	}
+	if !reflect.DeepEqual(plan.Versions, []int{1, 2}) || !reflect.DeepEqual(plan.Repeatables, []string{"view"}) {
+		t.Fatalf("Expected plan of every migration, got %+v", plan)
+	}
+	plan, err = PlanUpPhase(db, migrationFs, "migrations", PhasePre)
+	if err != nil {
+		t.Fatalf("PlanUpPhase failed: %s", err)
+	}
+	if !reflect.DeepEqual(plan.Versions, []int{1, 2}) {
+		t.Fatalf("Expected pre phase plan of every migration, got %+v", plan)
+	}
+	if _, err := PlanDown(db, migrationFs, "migrations", 0); err == nil {
+		t.Fatalf("Expected planning down on an empty database to fail")
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table'").Scan(&tables); err != nil {
+		t.Fatalf("Failed to count tables: %s", err)
+	}
+	if tables != 0 {
+		t.Fatalf("Expected dry runs not to create any tables, found %d", tables)
+	}
+}
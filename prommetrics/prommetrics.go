@@ -0,0 +1,126 @@
+// Package prommetrics exposes dbmigrator metrics to Prometheus.
+//
+//	collector := prommetrics.NewCollector()
+//	prometheus.MustRegister(collector)
+//	dbmigrator.SetMetrics(collector)
+package prommetrics
+
+import (
+	"time"
+
+	"github.com/NotCoffee418/dbmigrator"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector receiving dbmigrator metrics.
+// Series are labelled by operation only, the migration version of the latest operation
+// is a gauge so the number of series does not grow with every migration.
+// Repeatable migrations are reported with version 0.
+type Collector struct {
+	operations        *prometheus.CounterVec
+	failures          *prometheus.CounterVec
+	duration          *prometheus.HistogramVec
+	lastVersion       prometheus.Gauge
+	lastDuration      prometheus.Gauge
+	lastFailedVersion prometheus.Gauge
+	lockWait          prometheus.Histogram
+	installedVersion  prometheus.Gauge
+	availableVersion  prometheus.Gauge
+}
+
+var _ dbmigrator.Metrics = (*Collector)(nil)
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector returns a collector with metrics named dbmigrator_*.
+func NewCollector() *Collector {
+	return &Collector{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dbmigrator_operations_total",
+			Help: "Migration operations that succeeded, such as migrations applied and reverted.",
+		}, []string{"operation"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dbmigrator_failures_total",
+			Help: "Migration operations that failed.",
+		}, []string{"operation"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "dbmigrator_operation_duration_seconds",
+			Help:    "Duration of each migration operation.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10), // 10ms to about 45 minutes
+		}, []string{"operation"}),
+		lastVersion: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "dbmigrator_last_operation_version",
+			Help: "Migration version of the latest migration operation.",
+		}),
+		lastDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "dbmigrator_last_operation_duration_seconds",
+			Help: "Duration of the latest migration operation.",
+		}),
+		lastFailedVersion: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "dbmigrator_last_failed_version",
+			Help: "Migration version of the latest failed migration operation.",
+		}),
+		lockWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "dbmigrator_lock_wait_seconds",
+			Help:    "Time spent acquiring the migration lock.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10), // 1ms to about 4 minutes
+		}),
+		installedVersion: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "dbmigrator_installed_version",
+			Help: "Installed migration version of the database.",
+		}),
+		availableVersion: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "dbmigrator_available_version",
+			Help: "Highest available migration version.",
+		}),
+	}
+}
+
+// ObserveOperation implements dbmigrator.Metrics.
+func (c *Collector) ObserveOperation(operation dbmigrator.HistoryOperation, version int, duration time.Duration, err error) {
+	c.duration.WithLabelValues(string(operation)).Observe(duration.Seconds())
+	c.lastVersion.Set(float64(version))
+	c.lastDuration.Set(duration.Seconds())
+	if err != nil {
+		c.failures.WithLabelValues(string(operation)).Inc()
+		c.lastFailedVersion.Set(float64(version))
+		return
+	}
+	c.operations.WithLabelValues(string(operation)).Inc()
+}
+
+// ObserveLockWait implements dbmigrator.Metrics.
+func (c *Collector) ObserveLockWait(duration time.Duration) {
+	c.lockWait.Observe(duration.Seconds())
+}
+
+// SetVersions implements dbmigrator.Metrics.
+func (c *Collector) SetVersions(installed int, available int) {
+	c.installedVersion.Set(float64(installed))
+	c.availableVersion.Set(float64(available))
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.operations.Describe(ch)
+	c.failures.Describe(ch)
+	c.duration.Describe(ch)
+	c.lastVersion.Describe(ch)
+	c.lastDuration.Describe(ch)
+	c.lastFailedVersion.Describe(ch)
+	c.lockWait.Describe(ch)
+	c.installedVersion.Describe(ch)
+	c.availableVersion.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.operations.Collect(ch)
+	c.failures.Collect(ch)
+	c.duration.Collect(ch)
+	c.lastVersion.Collect(ch)
+	c.lastDuration.Collect(ch)
+	c.lastFailedVersion.Collect(ch)
+	c.lockWait.Collect(ch)
+	c.installedVersion.Collect(ch)
+	c.availableVersion.Collect(ch)
+}
@@ -0,0 +1,72 @@
+package prommetrics
+
+import (
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	"github.com/NotCoffee418/dbmigrator"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file:prommetrics.db?cache=shared&mode=memory")
+	if err != nil {
+		t.Fatalf("Failed to open sqlite database: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	collector := NewCollector()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+	dbmigrator.SetMetrics(collector)
+	defer dbmigrator.SetMetrics(nil)
+
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_two.sql": {Data: []byte("-- +up\nCREATE TABLE two (id INT);\n-- +down\nDROP TABLE two;\n")},
+		"migrations/0003_bad.sql": {Data: []byte("-- +up\nCREATE TABLE;\n")},
+	}
+	if err := dbmigrator.MigrateUp(db, migrationFs, "migrations"); err == nil {
+		t.Fatalf("Expected migration 3 to fail")
+	}
+
+	if applied := testutil.ToFloat64(collector.operations.WithLabelValues("up")); applied != 2 {
+		t.Fatalf("Expected 2 applied migrations, got %v", applied)
+	}
+	if failures := testutil.ToFloat64(collector.failures.WithLabelValues("up")); failures != 1 {
+		t.Fatalf("Expected 1 failed migration, got %v", failures)
+	}
+	if failed := testutil.ToFloat64(collector.lastFailedVersion); failed != 3 {
+		t.Fatalf("Expected migration 3 to be reported as the last failure, got %v", failed)
+	}
+	if last := testutil.ToFloat64(collector.lastVersion); last != 3 {
+		t.Fatalf("Expected migration 3 as the latest operation, got %v", last)
+	}
+	if installed := testutil.ToFloat64(collector.installedVersion); installed != 2 {
+		t.Fatalf("Expected installed version 2 after migration 3 failed, got %v", installed)
+	}
+	if available := testutil.ToFloat64(collector.availableVersion); available != 3 {
+		t.Fatalf("Expected available version 3, got %v", available)
+	}
+	if count := testutil.CollectAndCount(collector, "dbmigrator_lock_wait_seconds"); count != 1 {
+		t.Fatalf("Expected the lock wait histogram, got %d metrics", count)
+	}
+	if problems, err := testutil.GatherAndLint(registry); err != nil || len(problems) > 0 {
+		t.Fatalf("Metrics do not follow Prometheus conventions: %v %v", problems, err)
+	}
+
+	// The installed version is reported after migrating down
+	if err := dbmigrator.MigrateDown(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateDown failed: %s", err)
+	}
+	if installed := testutil.ToFloat64(collector.installedVersion); installed != 1 {
+		t.Fatalf("Expected installed version 1, got %v", installed)
+	}
+	if reverted := testutil.ToFloat64(collector.operations.WithLabelValues("down")); reverted != 1 {
+		t.Fatalf("Expected 1 reverted migration, got %v", reverted)
+	}
+}
@@ -2,6 +2,7 @@ package dbmigrator
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"os/exec"
@@ -9,10 +10,13 @@ import (
 	"testing"
 	"time"
 
+	"testing/fstest"
+
 	_ "github.com/denisenkom/go-mssqldb"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
+	_ "modernc.org/sqlite"
 )
 
 type dbTestDef struct {
@@ -43,6 +47,16 @@ var dbTestDefinitions = []dbTestDef{
 		driver:  "mysql",
 		connStr: "test:test@tcp(localhost:10001)/test",
 	},
+	{
+		queries: MariaDB,
+		driver:  "mysql",
+		connStr: "test:test@tcp(localhost:10003)/test",
+	},
+	{
+		queries: CockroachDB,
+		driver:  "postgres",
+		connStr: "host=localhost port=10004 user=root dbname=defaultdb sslmode=disable",
+	},
 }
 
 func TestAllQueriesOnAllDatabases(t *testing.T) {
@@ -75,54 +89,389 @@ func TestAllQueriesOnAllDatabases(t *testing.T) {
 			}
 			defer db.Close()
 
-			// CheckTableExists
-			var exists bool
-			err = db.QueryRow(def.queries.CheckTableExists).Scan(&exists)
-			if err != nil {
-				t.Fatalf("Failed to check table existence: %s\n", err)
-			}
-			if exists {
-				t.Fatalf("Table already exists")
+			testQueryDefinition(t, db, def.queries)
+		})
+	}
+}
+
+// inProcessTestDefinitions are databases that run inside the test process without services
+var inProcessTestDefinitions = []dbTestDef{
+	{
+		queries: SQLite,
+		driver:  "sqlite", // modernc.org/sqlite
+		connStr: ":memory:",
+	},
+}
+
+// openInProcessTestDB opens a fresh in-process database with a single connection
+func openInProcessTestDB(t *testing.T, def dbTestDef) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(def.driver, def.connStr)
+	if err != nil {
+		t.Fatalf("Failed to open %s database: %s", def.driver, err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func TestAllQueriesOnInProcessDatabases(t *testing.T) {
+	for _, def := range inProcessTestDefinitions {
+		t.Run(fmt.Sprintf("Testing %s", def.driver), func(t *testing.T) {
+			db := openInProcessTestDB(t, def)
+			testQueryDefinition(t, db, def.queries)
+		})
+	}
+}
+
+func TestMigrationsOnInProcessDatabases(t *testing.T) {
+	for _, def := range inProcessTestDefinitions {
+		t.Run(fmt.Sprintf("Testing %s", def.driver), func(t *testing.T) {
+			db := openInProcessTestDB(t, def)
+			SetDatabaseType(nil)
+
+			// The dialect is detected from the driver
+			detected, err := DetectDialect(db)
+			if err != nil || detected != def.queries {
+				t.Fatalf("Expected the %s query set to be detected, got %v", def.driver, err)
 			}
 
-			// CreateMigrationsTable
-			_, err = db.Exec(def.queries.CreateMigrationsTable)
-			if err != nil {
-				t.Fatalf("Failed to create table: %s\n", err)
+			migrationFs := fstest.MapFS{
+				"migrations/0001_one.sql": {Data: []byte(
+					"-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+				"migrations/0002_two.sql": {Data: []byte(
+					"-- +up\nCREATE TABLE two (id INT);\n-- +down\nDROP TABLE two;\n")},
+				"migrations/R_view.sql": {Data: []byte(
+					"-- +up\nDROP VIEW IF EXISTS one_view;\nCREATE VIEW one_view AS SELECT id FROM one;\n")},
+			}
+			if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+				t.Fatalf("MigrateUp failed: %s", err)
+			}
+			if err := MigrateDown(db, migrationFs, "migrations"); err != nil {
+				t.Fatalf("MigrateDown failed: %s", err)
 			}
 
-			// Validate table creation
-			err = db.QueryRow(def.queries.CheckTableExists).Scan(&exists)
-			if err != nil || !exists {
-				t.Fatalf("Table creation failed or table doesn't exist")
+			// Changed repeatable migrations are reapplied
+			migrationFs["migrations/R_view.sql"] = &fstest.MapFile{Data: []byte(
+				"-- +up\nDROP VIEW IF EXISTS one_view;\nCREATE VIEW one_view AS SELECT id, id AS copy FROM one;\n")}
+			if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+				t.Fatalf("MigrateUp failed: %s", err)
 			}
 
-			// InsertMigration
-			now := time.Now()
-			_, err = db.Exec(def.queries.InsertMigration, 100, now)
+			// Timestamps round trip through the history table, which records both repeatable runs
+			entries, err := History(db)
 			if err != nil {
-				t.Fatalf("Failed to insert migration: %s\n", err)
+				t.Fatalf("History failed: %s", err)
+			}
+			if len(entries) != 6 || entries[0].StartedAt.IsZero() || time.Since(entries[0].StartedAt) > time.Hour {
+				t.Fatalf("Unexpected history entries: %+v", entries)
 			}
 
-			// Validate migration insertion
-			var version int
-			err = db.QueryRow(def.queries.SelectInstalledVersion).Scan(&version)
-			if err != nil || version != 100 {
-				t.Fatalf("Migration insertion failed or version mismatch")
+			if err := Fresh(db, migrationFs, "migrations", true); err != nil {
+				t.Fatalf("Fresh failed: %s", err)
+			}
+			status, err := Status(db, migrationFs, "migrations")
+			if err != nil || status.InstalledVersion != 2 {
+				t.Fatalf("Expected version 2 after fresh, got %+v, %v", status, err)
 			}
+		})
+	}
+}
 
-			// DeleteMigration
-			_, err = db.Exec(def.queries.DeleteMigration, 100)
-			if err != nil {
-				t.Fatalf("Failed to delete migration: %s\n", err)
+// testQueryDefinition runs every query of a query set against an empty database
+func testQueryDefinition(t *testing.T, db *sql.DB, queries *MigrationQueryDefinition) {
+	t.Helper()
+	var err error
+
+	// CheckTableExists
+	var exists bool
+	err = db.QueryRow(queries.CheckTableExists).Scan(&exists)
+	if err != nil {
+		t.Fatalf("Failed to check table existence: %s\n", err)
+	}
+	if exists {
+		t.Fatalf("Table already exists")
+	}
+
+	// CreateMigrationsTable
+	_, err = db.Exec(queries.CreateMigrationsTable)
+	if err != nil {
+		t.Fatalf("Failed to create table: %s\n", err)
+	}
+
+	// Validate table creation
+	err = db.QueryRow(queries.CheckTableExists).Scan(&exists)
+	if err != nil || !exists {
+		t.Fatalf("Table creation failed or table doesn't exist")
+	}
+
+	// CheckTableExistsByName
+	for table, expected := range map[string]bool{"migrations": true, "migration_missing": false} {
+		err = db.QueryRow(queries.CheckTableExistsByName, table).Scan(&exists)
+		if err != nil || exists != expected {
+			t.Fatalf("Checking if table %s exists failed: %v\n", table, err)
+		}
+	}
+
+	// InsertMigration
+	now := time.Now()
+	_, err = db.Exec(queries.InsertMigration, 100, now)
+	if err != nil {
+		t.Fatalf("Failed to insert migration: %s\n", err)
+	}
+
+	// Validate migration insertion
+	var version int
+	err = db.QueryRow(queries.SelectInstalledVersion).Scan(&version)
+	if err != nil || version != 100 {
+		t.Fatalf("Migration insertion failed or version mismatch")
+	}
+
+	// SelectAppliedVersions
+	err = db.QueryRow(queries.SelectAppliedVersions).Scan(&version)
+	if err != nil || version != 100 {
+		t.Fatalf("Selecting applied versions failed or version mismatch")
+	}
+
+	// SelectLastApplied
+	var lastApplied any
+	err = db.QueryRow(queries.SelectLastApplied).Scan(&lastApplied)
+	if err != nil || lastApplied == nil {
+		t.Fatalf("Selecting last applied migration failed: %v\n", err)
+	}
+
+	// DeleteMigration
+	_, err = db.Exec(queries.DeleteMigration, 100)
+	if err != nil {
+		t.Fatalf("Failed to delete migration: %s\n", err)
+	}
+
+	// Validate migration deletion
+	err = db.QueryRow(queries.SelectInstalledVersion).Scan(&version)
+	if err != sql.ErrNoRows {
+		t.Fatalf("Migration deletion failed or version still exists")
+	}
+
+	// CreateScriptsTable must be idempotent
+	for i := 0; i < 2; i++ {
+		_, err = db.Exec(queries.CreateScriptsTable)
+		if err != nil {
+			t.Fatalf("Failed to create scripts table: %s\n", err)
+		}
+	}
+
+	// InsertMigrationScript
+	_, err = db.Exec(queries.InsertMigrationScript, 100, checksum("up"), checksum("down"), "down")
+	if err != nil {
+		t.Fatalf("Failed to insert migration script: %s\n", err)
+	}
+
+	// SelectMigrationScript
+	var script migrationScript
+	err = db.QueryRow(queries.SelectMigrationScript, 100).
+		Scan(&script.upChecksum, &script.downChecksum, &script.down)
+	if err != nil || script.downChecksum != checksum("down") || script.down.String != "down" {
+		t.Fatalf("Migration script insertion failed or contents mismatch")
+	}
+
+	// DeleteMigrationScript
+	_, err = db.Exec(queries.DeleteMigrationScript, 100)
+	if err != nil {
+		t.Fatalf("Failed to delete migration script: %s\n", err)
+	}
+	err = db.QueryRow(queries.SelectMigrationScript, 100).
+		Scan(&script.upChecksum, &script.downChecksum, &script.down)
+	if err != sql.ErrNoRows {
+		t.Fatalf("Migration script deletion failed or script still exists")
+	}
+
+	// CreateHistoryTable must be idempotent
+	for i := 0; i < 2; i++ {
+		_, err = db.Exec(queries.CreateHistoryTable)
+		if err != nil {
+			t.Fatalf("Failed to create history table: %s\n", err)
+		}
+	}
+
+	// InsertHistory
+	_, err = db.Exec(queries.InsertHistory, 100, "up", checksum("up"), "test", now, 5, true, nil)
+	if err != nil {
+		t.Fatalf("Failed to insert history: %s\n", err)
+	}
+
+	// SelectHistory
+	rows, err := db.Query(queries.SelectHistory)
+	if err != nil {
+		t.Fatalf("Failed to select history: %s\n", err)
+	}
+	historyCount := 0
+	for rows.Next() {
+		historyCount++
+	}
+	_ = rows.Close()
+	if historyCount != 1 {
+		t.Fatalf("History insertion failed, expected 1 entry but found %d", historyCount)
+	}
+
+	// SelectLastHistory
+	var lastSuccess bool
+	err = db.QueryRow(queries.SelectLastHistory).Scan(&lastSuccess)
+	if err != nil || !lastSuccess {
+		t.Fatalf("Selecting last history entry failed: %v\n", err)
+	}
+
+	// CreateRepeatablesTable must be idempotent
+	for i := 0; i < 2; i++ {
+		_, err = db.Exec(queries.CreateRepeatablesTable)
+		if err != nil {
+			t.Fatalf("Failed to create repeatables table: %s\n", err)
+		}
+	}
+
+	// InsertRepeatable
+	_, err = db.Exec(queries.InsertRepeatable, "view", checksum("view"), now)
+	if err != nil {
+		t.Fatalf("Failed to insert repeatable: %s\n", err)
+	}
+
+	// SelectRepeatables
+	var name, repeatableChecksum string
+	err = db.QueryRow(queries.SelectRepeatables).Scan(&name, &repeatableChecksum)
+	if err != nil || name != "view" || repeatableChecksum != checksum("view") {
+		t.Fatalf("Repeatable insertion failed or checksum mismatch")
+	}
+
+	// DeleteRepeatable
+	_, err = db.Exec(queries.DeleteRepeatable, "view")
+	if err != nil {
+		t.Fatalf("Failed to delete repeatable: %s\n", err)
+	}
+	err = db.QueryRow(queries.SelectRepeatables).Scan(&name, &repeatableChecksum)
+	if err != sql.ErrNoRows {
+		t.Fatalf("Repeatable deletion failed or repeatable still exists")
+	}
+
+	// CreateCheckpointsTable, InsertCheckpoint, SelectCheckpoint and DeleteCheckpoint
+	for i := 0; i < 2; i++ {
+		if _, err := db.Exec(queries.CreateCheckpointsTable); err != nil {
+			t.Fatalf("Failed to create checkpoints table: %s\n", err)
+		}
+	}
+	if _, err := db.Exec(queries.InsertCheckpoint, 1, "42", 3, int64(3000), now); err != nil {
+		t.Fatalf("Failed to insert checkpoint: %s\n", err)
+	}
+	var checkpoint string
+	var batches int
+	var rowsAffected int64
+	err = db.QueryRow(queries.SelectCheckpoint, 1).Scan(&checkpoint, &batches, &rowsAffected)
+	if err != nil || checkpoint != "42" || batches != 3 || rowsAffected != 3000 {
+		t.Fatalf("Failed to select checkpoint: %v\n", err)
+	}
+	if _, err := db.Exec(queries.DeleteCheckpoint, 1); err != nil {
+		t.Fatalf("Failed to delete checkpoint: %s\n", err)
+	}
+
+	// CreatePhasesTable, InsertPhase, SelectPhases and DeletePhases
+	for i := 0; i < 2; i++ {
+		if _, err := db.Exec(queries.CreatePhasesTable); err != nil {
+			t.Fatalf("Failed to create phases table: %s\n", err)
+		}
+	}
+	if _, err := db.Exec(queries.InsertPhase, 1, "pre", now); err != nil {
+		t.Fatalf("Failed to insert phase: %s\n", err)
+	}
+	var phaseVersion int
+	var phase string
+	err = db.QueryRow(queries.SelectPhases).Scan(&phaseVersion, &phase)
+	if err != nil || phaseVersion != 1 || phase != "pre" {
+		t.Fatalf("Failed to select phases: %v\n", err)
+	}
+	if _, err := db.Exec(queries.DeletePhases, 1); err != nil {
+		t.Fatalf("Failed to delete phases: %s\n", err)
+	}
+	err = db.QueryRow(queries.SelectPhases).Scan(&phaseVersion, &phase)
+	if err != sql.ErrNoRows {
+		t.Fatalf("Phase deletion failed or phase still exists")
+	}
+
+	// AcquireLock and ReleaseLock
+	switch queries.LockStrategy {
+	case LockAdvisory:
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to get connection: %s\n", err)
+		}
+		var acquired int
+		err = conn.QueryRowContext(context.Background(), queries.AcquireLock).Scan(&acquired)
+		if err != nil || acquired != 1 {
+			t.Fatalf("Failed to acquire lock: %v\n", err)
+		}
+		if _, err := conn.ExecContext(context.Background(), queries.ReleaseLock); err != nil {
+			t.Fatalf("Failed to release lock: %s\n", err)
+		}
+		_ = conn.Close()
+	case LockTable:
+		for i := 0; i < 2; i++ {
+			if _, err := db.Exec(queries.CreateLockTable); err != nil {
+				t.Fatalf("Failed to create lock table: %s\n", err)
 			}
+		}
+		if _, err := db.Exec(queries.AcquireLock, now, "test"); err != nil {
+			t.Fatalf("Failed to acquire lock: %s\n", err)
+		}
+		if _, err := db.Exec(queries.AcquireLock, now, "test"); err == nil {
+			t.Fatalf("Expected acquiring a held lock to fail")
+		}
+		if _, err := db.Exec(queries.ReleaseLock); err != nil {
+			t.Fatalf("Failed to release lock: %s\n", err)
+		}
+	}
 
-			// Validate migration deletion
-			err = db.QueryRow(def.queries.SelectInstalledVersion).Scan(&version)
-			if err != sql.ErrNoRows {
-				t.Fatalf("Migration deletion failed or version still exists")
+	// CreateSavepoint, RollbackToSavepoint and ReleaseSavepoint
+	if queries.CreateSavepoint != "" {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %s\n", err)
+		}
+		statements := []string{
+			fmt.Sprintf(queries.CreateSavepoint, "dbmigrator_1"),
+			fmt.Sprintf(queries.RollbackToSavepoint, "dbmigrator_1"),
+		}
+		if queries.ReleaseSavepoint != "" {
+			statements = append(statements, fmt.Sprintf(queries.ReleaseSavepoint, "dbmigrator_1"))
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				t.Fatalf("Failed to run savepoint statement (%s): %s\n", statement, err)
 			}
-		})
+		}
+		_ = tx.Rollback()
+	}
+
+	// SelectDropStatements drops every table
+	rows, err = db.Query(queries.SelectDropStatements)
+	if err != nil {
+		t.Fatalf("Failed to select drop statements: %s\n", err)
+	}
+	var dropStatements []string
+	for rows.Next() {
+		var statement string
+		if err := rows.Scan(&statement); err != nil {
+			t.Fatalf("Failed to read drop statement: %s\n", err)
+		}
+		dropStatements = append(dropStatements, statement)
+	}
+	_ = rows.Close()
+	for _, statement := range dropStatements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to drop object (%s): %s\n", statement, err)
+		}
+	}
+	err = db.QueryRow(queries.CheckTableExists).Scan(&exists)
+	if err != nil || exists {
+		t.Fatalf("Dropping all objects failed or migrations table still exists")
 	}
 }
 
@@ -158,6 +507,8 @@ func IsComposeUp() bool {
 	requiredServices := []string{
 		"dbmigrator-postgres",
 		"dbmigrator-mysql",
+		"dbmigrator-mariadb",
+		"dbmigrator-cockroachdb",
 		"dbmigrator-mssql"}
 
 	// Check if all required services are running
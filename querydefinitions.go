@@ -2,32 +2,225 @@ package dbmigrator
 
 var PostgreSQL = &MigrationQueryDefinition{
 	CheckTableExists:       "SELECT EXISTS (SELECT FROM information_schema.tables WHERE table_name = 'migrations')",
+	CheckTableExistsByName: "SELECT EXISTS (SELECT FROM information_schema.tables WHERE table_name = $1)",
 	CreateMigrationsTable:  "CREATE TABLE migrations (version INT NOT NULL, installed_at TIMESTAMP NOT NULL)",
 	InsertMigration:        "INSERT INTO migrations (version, installed_at) VALUES ($1, $2)",
 	DeleteMigration:        "DELETE FROM migrations WHERE version = $1",
 	SelectInstalledVersion: "SELECT version FROM migrations ORDER BY version DESC LIMIT 1",
+	SelectAppliedVersions:  "SELECT version FROM migrations ORDER BY version",
+	SelectLastApplied:      "SELECT installed_at FROM migrations ORDER BY installed_at DESC LIMIT 1",
+	CreateScriptsTable:     "CREATE TABLE IF NOT EXISTS migration_scripts (version INT NOT NULL PRIMARY KEY, up_checksum CHAR(64) NOT NULL, down_checksum CHAR(64) NOT NULL, down_sql TEXT NULL)",
+	InsertMigrationScript:  "INSERT INTO migration_scripts (version, up_checksum, down_checksum, down_sql) VALUES ($1, $2, $3, $4)",
+	SelectMigrationScript:  "SELECT up_checksum, down_checksum, down_sql FROM migration_scripts WHERE version = $1",
+	DeleteMigrationScript:  "DELETE FROM migration_scripts WHERE version = $1",
+	CreateHistoryTable:     "CREATE TABLE IF NOT EXISTS migration_history (id BIGSERIAL PRIMARY KEY, version INT NOT NULL, operation VARCHAR(16) NOT NULL, checksum CHAR(64) NULL, actor VARCHAR(255) NOT NULL, started_at TIMESTAMP NOT NULL, duration_ms BIGINT NOT NULL, success BOOLEAN NOT NULL, error_message TEXT NULL)",
+	InsertHistory:          "INSERT INTO migration_history (version, operation, checksum, actor, started_at, duration_ms, success, error_message) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+	SelectHistory:          "SELECT id, version, operation, checksum, actor, started_at, duration_ms, success, error_message FROM migration_history ORDER BY id",
+	SelectLastHistory:      "SELECT success FROM migration_history ORDER BY id DESC LIMIT 1",
+	CreateRepeatablesTable: "CREATE TABLE IF NOT EXISTS repeatable_migrations (name VARCHAR(255) NOT NULL PRIMARY KEY, checksum CHAR(64) NOT NULL, applied_at TIMESTAMP NOT NULL)",
+	SelectRepeatables:      "SELECT name, checksum FROM repeatable_migrations",
+	InsertRepeatable:       "INSERT INTO repeatable_migrations (name, checksum, applied_at) VALUES ($1, $2, $3)",
+	DeleteRepeatable:       "DELETE FROM repeatable_migrations WHERE name = $1",
+	SelectDropStatements:   "SELECT 'DROP MATERIALIZED VIEW IF EXISTS ' || quote_ident(matviewname) || ' CASCADE' FROM pg_matviews WHERE schemaname = current_schema() UNION ALL SELECT 'DROP VIEW IF EXISTS ' || quote_ident(viewname) || ' CASCADE' FROM pg_views WHERE schemaname = current_schema() UNION ALL SELECT 'DROP TABLE IF EXISTS ' || quote_ident(tablename) || ' CASCADE' FROM pg_tables WHERE schemaname = current_schema() UNION ALL SELECT 'DROP SEQUENCE IF EXISTS ' || quote_ident(sequencename) || ' CASCADE' FROM pg_sequences WHERE schemaname = current_schema() UNION ALL SELECT 'DROP ' || CASE p.prokind WHEN 'p' THEN 'PROCEDURE' WHEN 'a' THEN 'AGGREGATE' ELSE 'FUNCTION' END || ' IF EXISTS ' || quote_ident(p.proname) || '(' || pg_get_function_identity_arguments(p.oid) || ') CASCADE' FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace WHERE n.nspname = current_schema() AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = p.oid AND d.deptype = 'e') UNION ALL SELECT 'DROP TYPE IF EXISTS ' || quote_ident(t.typname) || ' CASCADE' FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace WHERE n.nspname = current_schema() AND t.typtype IN ('e', 'd', 'r') AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = t.oid AND d.deptype = 'e')",
+	LockStrategy:           LockAdvisory,
+	AcquireLock:            "SELECT CASE WHEN pg_try_advisory_lock(hashtext('dbmigrator')) THEN 1 ELSE 0 END",
+	ReleaseLock:            "SELECT pg_advisory_unlock(hashtext('dbmigrator'))",
+	TransactionalDDL:       true,
+	CreateSavepoint:        "SAVEPOINT %s",
+	RollbackToSavepoint:    "ROLLBACK TO SAVEPOINT %s",
+	ReleaseSavepoint:       "RELEASE SAVEPOINT %s",
+	CreateCheckpointsTable: "CREATE TABLE IF NOT EXISTS migration_checkpoints (version INT NOT NULL PRIMARY KEY, checkpoint TEXT NOT NULL, batches INT NOT NULL, rows_affected BIGINT NOT NULL, updated_at TIMESTAMP NOT NULL)",
+	SelectCheckpoint:       "SELECT checkpoint, batches, rows_affected FROM migration_checkpoints WHERE version = $1",
+	InsertCheckpoint:       "INSERT INTO migration_checkpoints (version, checkpoint, batches, rows_affected, updated_at) VALUES ($1, $2, $3, $4, $5)",
+	DeleteCheckpoint:       "DELETE FROM migration_checkpoints WHERE version = $1",
+	CreatePhasesTable:      "CREATE TABLE IF NOT EXISTS migration_phases (version INT NOT NULL, phase VARCHAR(16) NOT NULL, applied_at TIMESTAMP NOT NULL, PRIMARY KEY (version, phase))",
+	SelectPhases:           "SELECT version, phase FROM migration_phases ORDER BY version",
+	InsertPhase:            "INSERT INTO migration_phases (version, phase, applied_at) VALUES ($1, $2, $3)",
+	DeletePhases:           "DELETE FROM migration_phases WHERE version = $1",
+	RetryableErrors:        []string{"40P01", "55P03", "40001"}, // deadlock, lock timeout, serialization failure
 }
 
 var MySQL = &MigrationQueryDefinition{
-	CheckTableExists:       "SELECT EXISTS (SELECT * FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'migrations')",
-	CreateMigrationsTable:  "CREATE TABLE migrations (version INT NOT NULL, installed_at TIMESTAMP NOT NULL)",
-	InsertMigration:        "INSERT INTO migrations (version, installed_at) VALUES (?, ?)",
-	DeleteMigration:        "DELETE FROM migrations WHERE version = ?",
-	SelectInstalledVersion: "SELECT version FROM migrations ORDER BY version DESC LIMIT 1",
+	CheckTableExists:        "SELECT EXISTS (SELECT * FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'migrations')",
+	CheckTableExistsByName:  "SELECT EXISTS (SELECT * FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?)",
+	CreateMigrationsTable:   "CREATE TABLE migrations (version INT NOT NULL, installed_at TIMESTAMP NOT NULL)",
+	InsertMigration:         "INSERT INTO migrations (version, installed_at) VALUES (?, ?)",
+	DeleteMigration:         "DELETE FROM migrations WHERE version = ?",
+	SelectInstalledVersion:  "SELECT version FROM migrations ORDER BY version DESC LIMIT 1",
+	SelectAppliedVersions:   "SELECT version FROM migrations ORDER BY version",
+	SelectLastApplied:       "SELECT installed_at FROM migrations ORDER BY installed_at DESC LIMIT 1",
+	CreateScriptsTable:      "CREATE TABLE IF NOT EXISTS migration_scripts (version INT NOT NULL PRIMARY KEY, up_checksum CHAR(64) NOT NULL, down_checksum CHAR(64) NOT NULL, down_sql LONGTEXT NULL)",
+	InsertMigrationScript:   "INSERT INTO migration_scripts (version, up_checksum, down_checksum, down_sql) VALUES (?, ?, ?, ?)",
+	SelectMigrationScript:   "SELECT up_checksum, down_checksum, down_sql FROM migration_scripts WHERE version = ?",
+	DeleteMigrationScript:   "DELETE FROM migration_scripts WHERE version = ?",
+	CreateHistoryTable:      "CREATE TABLE IF NOT EXISTS migration_history (id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, version INT NOT NULL, operation VARCHAR(16) NOT NULL, checksum CHAR(64) NULL, actor VARCHAR(255) NOT NULL, started_at TIMESTAMP NOT NULL, duration_ms BIGINT NOT NULL, success BOOLEAN NOT NULL, error_message TEXT NULL)",
+	InsertHistory:           "INSERT INTO migration_history (version, operation, checksum, actor, started_at, duration_ms, success, error_message) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+	SelectHistory:           "SELECT id, version, operation, checksum, actor, started_at, duration_ms, success, error_message FROM migration_history ORDER BY id",
+	SelectLastHistory:       "SELECT success FROM migration_history ORDER BY id DESC LIMIT 1",
+	CreateRepeatablesTable:  "CREATE TABLE IF NOT EXISTS repeatable_migrations (name VARCHAR(255) NOT NULL PRIMARY KEY, checksum CHAR(64) NOT NULL, applied_at TIMESTAMP NOT NULL)",
+	SelectRepeatables:       "SELECT name, checksum FROM repeatable_migrations",
+	InsertRepeatable:        "INSERT INTO repeatable_migrations (name, checksum, applied_at) VALUES (?, ?, ?)",
+	DeleteRepeatable:        "DELETE FROM repeatable_migrations WHERE name = ?",
+	SelectDropStatements:    "SELECT CONCAT('DROP VIEW IF EXISTS `', table_name, '`') FROM information_schema.views WHERE table_schema = DATABASE() UNION ALL SELECT CONCAT('DROP TABLE IF EXISTS `', table_name, '`') FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' UNION ALL SELECT CONCAT('DROP ', routine_type, ' IF EXISTS `', routine_name, '`') FROM information_schema.routines WHERE routine_schema = DATABASE()",
+	DisableForeignKeyChecks: "SET FOREIGN_KEY_CHECKS = 0",
+	EnableForeignKeyChecks:  "SET FOREIGN_KEY_CHECKS = 1",
+	LockStrategy:            LockAdvisory,
+	AcquireLock:             "SELECT GET_LOCK('dbmigrator', 0)",
+	ReleaseLock:             "SELECT RELEASE_LOCK('dbmigrator')",
+	CreateSavepoint:         "SAVEPOINT %s",
+	RollbackToSavepoint:     "ROLLBACK TO SAVEPOINT %s",
+	ReleaseSavepoint:        "RELEASE SAVEPOINT %s",
+	CreateCheckpointsTable:  "CREATE TABLE IF NOT EXISTS migration_checkpoints (version INT NOT NULL PRIMARY KEY, checkpoint TEXT NOT NULL, batches INT NOT NULL, rows_affected BIGINT NOT NULL, updated_at TIMESTAMP NOT NULL)",
+	SelectCheckpoint:        "SELECT checkpoint, batches, rows_affected FROM migration_checkpoints WHERE version = ?",
+	InsertCheckpoint:        "INSERT INTO migration_checkpoints (version, checkpoint, batches, rows_affected, updated_at) VALUES (?, ?, ?, ?, ?)",
+	DeleteCheckpoint:        "DELETE FROM migration_checkpoints WHERE version = ?",
+	CreatePhasesTable:       "CREATE TABLE IF NOT EXISTS migration_phases (version INT NOT NULL, phase VARCHAR(16) NOT NULL, applied_at TIMESTAMP NOT NULL, PRIMARY KEY (version, phase))",
+	SelectPhases:            "SELECT version, phase FROM migration_phases ORDER BY version",
+	InsertPhase:             "INSERT INTO migration_phases (version, phase, applied_at) VALUES (?, ?, ?)",
+	DeletePhases:            "DELETE FROM migration_phases WHERE version = ?",
+	SQLSyntax:               SyntaxMySQL,
+	RetryableErrors:         []string{"1213", "1205"}, // deadlock, lock wait timeout
 }
 
 var SQLite = &MigrationQueryDefinition{
-	CheckTableExists:       "SELECT EXISTS (SELECT name FROM sqlite_master WHERE type='table' AND name='migrations')",
-	CreateMigrationsTable:  "CREATE TABLE migrations (version INT NOT NULL, installed_at TIMESTAMP NOT NULL)",
-	InsertMigration:        "INSERT INTO migrations (version, installed_at) VALUES (?, ?)",
-	DeleteMigration:        "DELETE FROM migrations WHERE version = ?",
-	SelectInstalledVersion: "SELECT version FROM migrations ORDER BY version DESC LIMIT 1",
+	CheckTableExists:        "SELECT EXISTS (SELECT name FROM sqlite_master WHERE type='table' AND name='migrations')",
+	CheckTableExistsByName:  "SELECT EXISTS (SELECT name FROM sqlite_master WHERE type='table' AND name=?)",
+	CreateMigrationsTable:   "CREATE TABLE migrations (version INT NOT NULL, installed_at TIMESTAMP NOT NULL)",
+	InsertMigration:         "INSERT INTO migrations (version, installed_at) VALUES (?, ?)",
+	DeleteMigration:         "DELETE FROM migrations WHERE version = ?",
+	SelectInstalledVersion:  "SELECT version FROM migrations ORDER BY version DESC LIMIT 1",
+	SelectAppliedVersions:   "SELECT version FROM migrations ORDER BY version",
+	SelectLastApplied:       "SELECT installed_at FROM migrations ORDER BY installed_at DESC LIMIT 1",
+	CreateScriptsTable:      "CREATE TABLE IF NOT EXISTS migration_scripts (version INT NOT NULL PRIMARY KEY, up_checksum CHAR(64) NOT NULL, down_checksum CHAR(64) NOT NULL, down_sql TEXT NULL)",
+	InsertMigrationScript:   "INSERT INTO migration_scripts (version, up_checksum, down_checksum, down_sql) VALUES (?, ?, ?, ?)",
+	SelectMigrationScript:   "SELECT up_checksum, down_checksum, down_sql FROM migration_scripts WHERE version = ?",
+	DeleteMigrationScript:   "DELETE FROM migration_scripts WHERE version = ?",
+	CreateHistoryTable:      "CREATE TABLE IF NOT EXISTS migration_history (id INTEGER PRIMARY KEY AUTOINCREMENT, version INT NOT NULL, operation VARCHAR(16) NOT NULL, checksum CHAR(64) NULL, actor VARCHAR(255) NOT NULL, started_at TIMESTAMP NOT NULL, duration_ms BIGINT NOT NULL, success BOOLEAN NOT NULL, error_message TEXT NULL)",
+	InsertHistory:           "INSERT INTO migration_history (version, operation, checksum, actor, started_at, duration_ms, success, error_message) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+	SelectHistory:           "SELECT id, version, operation, checksum, actor, started_at, duration_ms, success, error_message FROM migration_history ORDER BY id",
+	SelectLastHistory:       "SELECT success FROM migration_history ORDER BY id DESC LIMIT 1",
+	CreateRepeatablesTable:  "CREATE TABLE IF NOT EXISTS repeatable_migrations (name VARCHAR(255) NOT NULL PRIMARY KEY, checksum CHAR(64) NOT NULL, applied_at TIMESTAMP NOT NULL)",
+	SelectRepeatables:       "SELECT name, checksum FROM repeatable_migrations",
+	InsertRepeatable:        "INSERT INTO repeatable_migrations (name, checksum, applied_at) VALUES (?, ?, ?)",
+	DeleteRepeatable:        "DELETE FROM repeatable_migrations WHERE name = ?",
+	SelectDropStatements:    "SELECT 'DROP ' || UPPER(type) || ' IF EXISTS \"' || name || '\"' FROM sqlite_master WHERE type IN ('view', 'trigger', 'table') AND name NOT LIKE 'sqlite_%' ORDER BY CASE type WHEN 'view' THEN 0 WHEN 'trigger' THEN 1 ELSE 2 END",
+	DisableForeignKeyChecks: "PRAGMA foreign_keys = OFF",
+	EnableForeignKeyChecks:  "PRAGMA foreign_keys = ON",
+	TransactionalDDL:        true,
+	CreateSavepoint:         "SAVEPOINT %s",
+	RollbackToSavepoint:     "ROLLBACK TO SAVEPOINT %s",
+	ReleaseSavepoint:        "RELEASE SAVEPOINT %s",
+	CreateCheckpointsTable:  "CREATE TABLE IF NOT EXISTS migration_checkpoints (version INT NOT NULL PRIMARY KEY, checkpoint TEXT NOT NULL, batches INT NOT NULL, rows_affected BIGINT NOT NULL, updated_at TIMESTAMP NOT NULL)",
+	SelectCheckpoint:        "SELECT checkpoint, batches, rows_affected FROM migration_checkpoints WHERE version = ?",
+	InsertCheckpoint:        "INSERT INTO migration_checkpoints (version, checkpoint, batches, rows_affected, updated_at) VALUES (?, ?, ?, ?, ?)",
+	DeleteCheckpoint:        "DELETE FROM migration_checkpoints WHERE version = ?",
+	CreatePhasesTable:       "CREATE TABLE IF NOT EXISTS migration_phases (version INT NOT NULL, phase VARCHAR(16) NOT NULL, applied_at TIMESTAMP NOT NULL, PRIMARY KEY (version, phase))",
+	SelectPhases:            "SELECT version, phase FROM migration_phases ORDER BY version",
+	InsertPhase:             "INSERT INTO migration_phases (version, phase, applied_at) VALUES (?, ?, ?)",
+	DeletePhases:            "DELETE FROM migration_phases WHERE version = ?",
+	RetryableErrors:         []string{"5", "261", "517", "773", "6", "262"}, // SQLITE_BUSY and SQLITE_LOCKED with extended codes
 }
 
 var SQLServer = &MigrationQueryDefinition{
 	CheckTableExists:       "SELECT CASE WHEN EXISTS (SELECT * FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_NAME = 'migrations') THEN 1 ELSE 0 END",
+	CheckTableExistsByName: "SELECT CASE WHEN EXISTS (SELECT * FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_NAME = @p1) THEN 1 ELSE 0 END",
 	CreateMigrationsTable:  "CREATE TABLE migrations (version INT NOT NULL, installed_at DATETIME NOT NULL)",
 	InsertMigration:        "INSERT INTO migrations (version, installed_at) VALUES (@p1, @p2)",
 	DeleteMigration:        "DELETE FROM migrations WHERE version = @p1",
 	SelectInstalledVersion: "SELECT TOP 1 version FROM migrations ORDER BY version DESC",
+	SelectAppliedVersions:  "SELECT version FROM migrations ORDER BY version",
+	SelectLastApplied:      "SELECT TOP 1 installed_at FROM migrations ORDER BY installed_at DESC",
+	CreateScriptsTable:     "IF OBJECT_ID(N'migration_scripts', N'U') IS NULL CREATE TABLE migration_scripts (version INT NOT NULL PRIMARY KEY, up_checksum CHAR(64) NOT NULL, down_checksum CHAR(64) NOT NULL, down_sql NVARCHAR(MAX) NULL)",
+	InsertMigrationScript:  "INSERT INTO migration_scripts (version, up_checksum, down_checksum, down_sql) VALUES (@p1, @p2, @p3, @p4)",
+	SelectMigrationScript:  "SELECT up_checksum, down_checksum, down_sql FROM migration_scripts WHERE version = @p1",
+	DeleteMigrationScript:  "DELETE FROM migration_scripts WHERE version = @p1",
+	CreateHistoryTable:     "IF OBJECT_ID(N'migration_history', N'U') IS NULL CREATE TABLE migration_history (id BIGINT IDENTITY(1,1) PRIMARY KEY, version INT NOT NULL, operation VARCHAR(16) NOT NULL, checksum CHAR(64) NULL, actor VARCHAR(255) NOT NULL, started_at DATETIME NOT NULL, duration_ms BIGINT NOT NULL, success BIT NOT NULL, error_message NVARCHAR(MAX) NULL)",
+	InsertHistory:          "INSERT INTO migration_history (version, operation, checksum, actor, started_at, duration_ms, success, error_message) VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)",
+	SelectHistory:          "SELECT id, version, operation, checksum, actor, started_at, duration_ms, success, error_message FROM migration_history ORDER BY id",
+	SelectLastHistory:      "SELECT TOP 1 success FROM migration_history ORDER BY id DESC",
+	CreateRepeatablesTable: "IF OBJECT_ID(N'repeatable_migrations', N'U') IS NULL CREATE TABLE repeatable_migrations (name NVARCHAR(255) NOT NULL PRIMARY KEY, checksum CHAR(64) NOT NULL, applied_at DATETIME NOT NULL)",
+	SelectRepeatables:      "SELECT name, checksum FROM repeatable_migrations",
+	InsertRepeatable:       "INSERT INTO repeatable_migrations (name, checksum, applied_at) VALUES (@p1, @p2, @p3)",
+	DeleteRepeatable:       "DELETE FROM repeatable_migrations WHERE name = @p1",
+	SelectDropStatements:   "SELECT statement FROM (SELECT 1 AS ord, 'ALTER TABLE ' + QUOTENAME(OBJECT_SCHEMA_NAME(parent_object_id)) + '.' + QUOTENAME(OBJECT_NAME(parent_object_id)) + ' DROP CONSTRAINT ' + QUOTENAME(name) AS statement FROM sys.foreign_keys WHERE schema_id = SCHEMA_ID() UNION ALL SELECT 2, 'DROP VIEW ' + QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(name) FROM sys.views WHERE schema_id = SCHEMA_ID() UNION ALL SELECT 3, 'DROP TABLE ' + QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(name) FROM sys.tables WHERE schema_id = SCHEMA_ID() AND is_ms_shipped = 0 UNION ALL SELECT 4, 'DROP PROCEDURE ' + QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(name) FROM sys.procedures WHERE schema_id = SCHEMA_ID() AND is_ms_shipped = 0 UNION ALL SELECT 5, 'DROP FUNCTION ' + QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(name) FROM sys.objects WHERE schema_id = SCHEMA_ID() AND type IN ('FN', 'IF', 'TF') AND is_ms_shipped = 0) drops ORDER BY ord",
+	LockStrategy:           LockAdvisory,
+	AcquireLock:            "DECLARE @result INT; EXEC @result = sp_getapplock @Resource = 'dbmigrator', @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0; SELECT CASE WHEN @result >= 0 THEN 1 ELSE 0 END",
+	ReleaseLock:            "EXEC sp_releaseapplock @Resource = 'dbmigrator', @LockOwner = 'Session'",
+	TransactionalDDL:       true,
+	CreateSavepoint:        "SAVE TRANSACTION %s",
+	RollbackToSavepoint:    "ROLLBACK TRANSACTION %s",
+	CreateCheckpointsTable: "IF OBJECT_ID(N'migration_checkpoints', N'U') IS NULL CREATE TABLE migration_checkpoints (version INT NOT NULL PRIMARY KEY, checkpoint NVARCHAR(MAX) NOT NULL, batches INT NOT NULL, rows_affected BIGINT NOT NULL, updated_at DATETIME NOT NULL)",
+	SelectCheckpoint:       "SELECT checkpoint, batches, rows_affected FROM migration_checkpoints WHERE version = @p1",
+	InsertCheckpoint:       "INSERT INTO migration_checkpoints (version, checkpoint, batches, rows_affected, updated_at) VALUES (@p1, @p2, @p3, @p4, @p5)",
+	DeleteCheckpoint:       "DELETE FROM migration_checkpoints WHERE version = @p1",
+	CreatePhasesTable:      "IF OBJECT_ID(N'migration_phases', N'U') IS NULL CREATE TABLE migration_phases (version INT NOT NULL, phase NVARCHAR(16) NOT NULL, applied_at DATETIME NOT NULL, PRIMARY KEY (version, phase))",
+	SelectPhases:           "SELECT version, phase FROM migration_phases ORDER BY version",
+	InsertPhase:            "INSERT INTO migration_phases (version, phase, applied_at) VALUES (@p1, @p2, @p3)",
+	DeletePhases:           "DELETE FROM migration_phases WHERE version = @p1",
+	RetryableErrors:        []string{"1205", "1222"}, // deadlock victim, lock request timeout
 }
+
+var DuckDB = &MigrationQueryDefinition{
+	CheckTableExists:       "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'migrations')",
+	CheckTableExistsByName: "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1)",
+	CreateMigrationsTable:  "CREATE TABLE migrations (version INTEGER NOT NULL, installed_at TIMESTAMPTZ NOT NULL)",
+	InsertMigration:        "INSERT INTO migrations (version, installed_at) VALUES ($1, $2)",
+	DeleteMigration:        "DELETE FROM migrations WHERE version = $1",
+	SelectInstalledVersion: "SELECT version FROM migrations ORDER BY version DESC LIMIT 1",
+	SelectAppliedVersions:  "SELECT version FROM migrations ORDER BY version",
+	SelectLastApplied:      "SELECT installed_at FROM migrations ORDER BY installed_at DESC LIMIT 1",
+	CreateScriptsTable:     "CREATE TABLE IF NOT EXISTS migration_scripts (version INTEGER NOT NULL PRIMARY KEY, up_checksum VARCHAR NOT NULL, down_checksum VARCHAR NOT NULL, down_sql VARCHAR NULL)",
+	InsertMigrationScript:  "INSERT INTO migration_scripts (version, up_checksum, down_checksum, down_sql) VALUES ($1, $2, $3, $4)",
+	SelectMigrationScript:  "SELECT up_checksum, down_checksum, down_sql FROM migration_scripts WHERE version = $1",
+	DeleteMigrationScript:  "DELETE FROM migration_scripts WHERE version = $1",
+	CreateHistoryTable:     "CREATE SEQUENCE IF NOT EXISTS migration_history_id_seq; CREATE TABLE IF NOT EXISTS migration_history (id BIGINT PRIMARY KEY DEFAULT nextval('migration_history_id_seq'), version INTEGER NOT NULL, operation VARCHAR NOT NULL, checksum VARCHAR NULL, actor VARCHAR NOT NULL, started_at TIMESTAMPTZ NOT NULL, duration_ms BIGINT NOT NULL, success BOOLEAN NOT NULL, error_message VARCHAR NULL)",
+	InsertHistory:          "INSERT INTO migration_history (version, operation, checksum, actor, started_at, duration_ms, success, error_message) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+	SelectHistory:          "SELECT id, version, operation, checksum, actor, started_at, duration_ms, success, error_message FROM migration_history ORDER BY id",
+	SelectLastHistory:      "SELECT success FROM migration_history ORDER BY id DESC LIMIT 1",
+	CreateRepeatablesTable: "CREATE TABLE IF NOT EXISTS repeatable_migrations (name VARCHAR NOT NULL PRIMARY KEY, checksum VARCHAR NOT NULL, applied_at TIMESTAMPTZ NOT NULL)",
+	SelectRepeatables:      "SELECT name, checksum FROM repeatable_migrations",
+	InsertRepeatable:       "INSERT INTO repeatable_migrations (name, checksum, applied_at) VALUES ($1, $2, $3)",
+	DeleteRepeatable:       "DELETE FROM repeatable_migrations WHERE name = $1",
+	SelectDropStatements:   "SELECT 'DROP VIEW IF EXISTS \"' || view_name || '\"' FROM duckdb_views() WHERE database_name = current_database() AND schema_name = current_schema() AND NOT internal UNION ALL SELECT 'DROP TABLE IF EXISTS \"' || table_name || '\" CASCADE' FROM duckdb_tables() WHERE database_name = current_database() AND schema_name = current_schema() UNION ALL SELECT 'DROP SEQUENCE IF EXISTS \"' || sequence_name || '\" CASCADE' FROM duckdb_sequences() WHERE database_name = current_database() AND schema_name = current_schema() UNION ALL SELECT 'DROP MACRO IF EXISTS \"' || function_name || '\"' FROM duckdb_functions() WHERE database_name = current_database() AND schema_name = current_schema() AND NOT internal AND function_type = 'macro'",
+	CreateCheckpointsTable: "CREATE TABLE IF NOT EXISTS migration_checkpoints (version INTEGER NOT NULL PRIMARY KEY, checkpoint VARCHAR NOT NULL, batches INTEGER NOT NULL, rows_affected BIGINT NOT NULL, updated_at TIMESTAMPTZ NOT NULL)",
+	SelectCheckpoint:       "SELECT checkpoint, batches, rows_affected FROM migration_checkpoints WHERE version = $1",
+	InsertCheckpoint:       "INSERT INTO migration_checkpoints (version, checkpoint, batches, rows_affected, updated_at) VALUES ($1, $2, $3, $4, $5)",
+	DeleteCheckpoint:       "DELETE FROM migration_checkpoints WHERE version = $1",
+	CreatePhasesTable:      "CREATE TABLE IF NOT EXISTS migration_phases (version INTEGER NOT NULL, phase VARCHAR NOT NULL, applied_at TIMESTAMPTZ NOT NULL, PRIMARY KEY (version, phase))",
+	SelectPhases:           "SELECT version, phase FROM migration_phases ORDER BY version",
+	InsertPhase:            "INSERT INTO migration_phases (version, phase, applied_at) VALUES ($1, $2, $3)",
+	DeletePhases:           "DELETE FROM migration_phases WHERE version = $1",
+	TransactionalDDL:       true,
+}
+
+// CockroachDB builds on the PostgreSQL query set.
+// pg_advisory_lock does not lock on CockroachDB so a lock table is used instead,
+// and schema changes run outside explicit transactions as recommended by CockroachDB.
+var CockroachDB = func() *MigrationQueryDefinition {
+	def := *PostgreSQL
+	def.CheckTableExists = "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'migrations')"
+	def.CheckTableExistsByName = "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1)"
+	def.SelectDropStatements = "SELECT 'DROP VIEW IF EXISTS ' || quote_ident(table_name) || ' CASCADE' FROM information_schema.views WHERE table_schema = current_schema() UNION ALL SELECT 'DROP TABLE IF EXISTS ' || quote_ident(table_name) || ' CASCADE' FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' AND table_name <> 'migration_lock' UNION ALL SELECT 'DROP SEQUENCE IF EXISTS ' || quote_ident(sequence_name) || ' CASCADE' FROM information_schema.sequences WHERE sequence_schema = current_schema() UNION ALL SELECT 'DROP TYPE IF EXISTS ' || quote_ident(t.typname) FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace WHERE n.nspname = current_schema() AND t.typtype = 'e'"
+	def.LockStrategy = LockTable
+	def.CreateLockTable = "CREATE TABLE IF NOT EXISTS migration_lock (id INT NOT NULL PRIMARY KEY, locked_at TIMESTAMPTZ NOT NULL, locked_by STRING NOT NULL)"
+	def.AcquireLock = "INSERT INTO migration_lock (id, locked_at, locked_by) VALUES (1, $1, $2)"
+	def.ReleaseLock = "DELETE FROM migration_lock WHERE id = 1"
+	def.TransactionalDDL = false
+	def.StatementsOutsideTransaction = true
+	return &def
+}()
+
+// MariaDB builds on the MySQL query set.
+// Timestamps use DATETIME(6) because TIMESTAMP columns are updated automatically
+// unless explicit_defaults_for_timestamp is enabled, and sequences and
+// system versioned tables are dropped by Fresh.
+var MariaDB = func() *MigrationQueryDefinition {
+	def := *MySQL
+	def.CreateMigrationsTable = "CREATE TABLE migrations (version INT NOT NULL, installed_at DATETIME(6) NOT NULL)"
+	def.CreateHistoryTable = "CREATE TABLE IF NOT EXISTS migration_history (id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, version INT NOT NULL, operation VARCHAR(16) NOT NULL, checksum CHAR(64) NULL, actor VARCHAR(255) NOT NULL, started_at DATETIME(6) NOT NULL, duration_ms BIGINT NOT NULL, success BOOLEAN NOT NULL, error_message TEXT NULL)"
+	def.CreateRepeatablesTable = "CREATE TABLE IF NOT EXISTS repeatable_migrations (name VARCHAR(255) NOT NULL PRIMARY KEY, checksum CHAR(64) NOT NULL, applied_at DATETIME(6) NOT NULL)"
+	def.CreateCheckpointsTable = "CREATE TABLE IF NOT EXISTS migration_checkpoints (version INT NOT NULL PRIMARY KEY, checkpoint TEXT NOT NULL, batches INT NOT NULL, rows_affected BIGINT NOT NULL, updated_at DATETIME(6) NOT NULL)"
+	def.CreatePhasesTable = "CREATE TABLE IF NOT EXISTS migration_phases (version INT NOT NULL, phase VARCHAR(16) NOT NULL, applied_at DATETIME(6) NOT NULL, PRIMARY KEY (version, phase))"
+	def.SelectDropStatements = "SELECT CONCAT('DROP VIEW IF EXISTS `', table_name, '`') FROM information_schema.views WHERE table_schema = DATABASE() UNION ALL SELECT CONCAT('DROP TABLE IF EXISTS `', table_name, '`') FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type IN ('BASE TABLE', 'SYSTEM VERSIONED') UNION ALL SELECT CONCAT('DROP SEQUENCE IF EXISTS `', table_name, '`') FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'SEQUENCE' UNION ALL SELECT CONCAT('DROP ', routine_type, ' IF EXISTS `', routine_name, '`') FROM information_schema.routines WHERE routine_schema = DATABASE()"
+	return &def
+}()
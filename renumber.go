@@ -0,0 +1,194 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MigrationRename describes a migration file renamed to resolve a version conflict.
+type MigrationRename struct {
+	From       string
+	To         string
+	OldVersion int
+	NewVersion int
+}
+
+var renumberFileRx = regexp.MustCompile(`^(\d{4})_(\S+\.sql)$`)
+
+// PlanRenumber finds unapplied migration files in migrationDir on disk that share a version
+// with another file or have a version lower than the installed version, such as after merging
+// branches that both added a migration, and plans renaming them to the next free versions.
+// Their relative order is preserved and versions applied on db are never renamed.
+//
+// Param: db - database to read applied versions from, may be nil to only resolve duplicate versions
+func PlanRenumber(db *sql.DB, migrationDir string) ([]MigrationRename, error) {
+	return PlanRenumberWith(optionalExecutor(db), migrationDir)
+}
+
+// PlanRenumberWith works like PlanRenumber with queries run by an Executor.
+func PlanRenumberWith(db Executor, migrationDir string) ([]MigrationRename, error) {
+	// Walk subdirectories like listing migrations does
+	migrationFs := os.DirFS(migrationDir)
+	files, _, err := walkMigrationFiles(migrationFs, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	// Group migration files by version
+	filesByVersion := make(map[int][]string)
+	highestVersion := 0
+	for _, file := range files {
+		matches := renumberFileRx.FindStringSubmatch(path.Base(file))
+		if matches == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(matches[1])
+		filesByVersion[version] = append(filesByVersion[version], file)
+		if version > highestVersion {
+			highestVersion = version
+		}
+	}
+
+	// Applied versions on the database
+	applied := make(map[int]bool)
+	installedVersion := 0
+	var bound *queryExecutor
+	if db != nil {
+		if bound, err = withQueries(db); err != nil {
+			return nil, err
+		}
+		installedVersion, err = getInstalledMigrationVersion(bound)
+		if err != nil {
+			return nil, err
+		}
+		appliedVersions, err := getAppliedMigrationVersions(bound, installedVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range appliedVersions {
+			applied[version] = true
+		}
+	}
+
+	// Select files to move, in version order
+	versions := make([]int, 0, len(filesByVersion))
+	for version := range filesByVersion {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	var toMove []MigrationRename
+	for _, version := range versions {
+		versionFiles := filesByVersion[version]
+		sort.Strings(versionFiles)
+
+		// Keep the applied file, or the first file of an unapplied version
+		keep := versionFiles[0]
+		if applied[version] {
+			if len(versionFiles) > 1 {
+				keep, err = findAppliedMigrationFile(bound, migrationFs, version, versionFiles)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				continue
+			}
+		} else if version < installedVersion {
+			// Unapplied versions below the installed version are out of order
+			keep = ""
+		}
+		for _, file := range versionFiles {
+			if file != keep {
+				toMove = append(toMove, MigrationRename{From: file, OldVersion: version})
+			}
+		}
+	}
+
+	// Assign the next free versions
+	nextVersion := highestVersion
+	if installedVersion > nextVersion {
+		nextVersion = installedVersion
+	}
+	for i := range toMove {
+		nextVersion++
+		if nextVersion > 9999 {
+			return nil, fmt.Errorf("can not renumber migrations beyond version 9999")
+		}
+		rest := renumberFileRx.FindStringSubmatch(path.Base(toMove[i].From))[2]
+		toMove[i].NewVersion = nextVersion
+		toMove[i].To = path.Join(path.Dir(toMove[i].From), fmt.Sprintf("%04d_%s", nextVersion, rest))
+	}
+	for i := range toMove {
+		toMove[i].From = filepath.Join(migrationDir, filepath.FromSlash(toMove[i].From))
+		toMove[i].To = filepath.Join(migrationDir, filepath.FromSlash(toMove[i].To))
+	}
+	return toMove, nil
+}
+
+// Renumber renames the migration files planned by PlanRenumber.
+//
+// Returns: the performed renames
+func Renumber(db *sql.DB, migrationDir string) ([]MigrationRename, error) {
+	return RenumberWith(optionalExecutor(db), migrationDir)
+}
+
+// optionalExecutor adapts db, keeping a nil db nil
+func optionalExecutor(db *sql.DB) Executor {
+	if db == nil {
+		return nil
+	}
+	return SQLExecutor(db)
+}
+
+// RenumberWith works like Renumber with queries run by an Executor.
+func RenumberWith(db Executor, migrationDir string) ([]MigrationRename, error) {
+	renames, err := PlanRenumberWith(db, migrationDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, rename := range renames {
+		if _, err := os.Stat(rename.To); err == nil {
+			return nil, fmt.Errorf("can not rename %s, %s already exists", rename.From, rename.To)
+		}
+		if err := os.Rename(rename.From, rename.To); err != nil {
+			return nil, fmt.Errorf("error renaming migration file: %w", err)
+		}
+		log.Printf("Renumbered migration %s to %s\n", rename.From, path.Base(rename.To))
+	}
+	if len(renames) == 0 {
+		log.Println("No migrations to renumber.")
+	}
+	return renames, nil
+}
+
+// findAppliedMigrationFile finds which of the files sharing an applied version was applied
+// by comparing their up sections to the checksum stored when the version was applied.
+func findAppliedMigrationFile(db *queryExecutor, migrationFs fs.FS, version int, files []string) (string, error) {
+	stored, err := selectMigrationScript(db, version)
+	if err != nil {
+		return "", err
+	}
+	if stored == nil {
+		return "", fmt.Errorf(
+			"version %d is applied and shared by %d files, but it is unknown which one was applied",
+			version, len(files))
+	}
+	for _, file := range files {
+		migration := migrationFileInfo{version: version, file: file}
+		if err := loadMigrationContents(migrationFs, &migration); err != nil {
+			return "", err
+		}
+		if checksum(migration.contents.up) == stored.upChecksum {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("version %d is applied but none of its files match the applied migration", version)
+}
@@ -0,0 +1,87 @@
+package dbmigrator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenumberResolvesConflicts(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationDir := filepath.Join(t.TempDir(), "migrations")
+	if err := os.MkdirAll(migrationDir, 0o755); err != nil {
+		t.Fatalf("Failed to create migrations directory: %s", err)
+	}
+	writeMigration := func(name string, up string) {
+		err := os.WriteFile(filepath.Join(migrationDir, name), []byte("-- +up\n"+up+"\n"), 0o644)
+		if err != nil {
+			t.Fatalf("Failed to write migration: %s", err)
+		}
+	}
+	writeMigration("0001_one.sql", "CREATE TABLE one (id INT);")
+	writeMigration("0002_users.sql", "CREATE TABLE users (id INT);")
+	writeMigration("0003_three.sql", "CREATE TABLE three (id INT);")
+	if err := MigrateUp(db, os.DirFS(filepath.Dir(migrationDir)), "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+
+	// Another branch added 0002 and 0003 as well, and this branch adds 0004
+	writeMigration("0002_posts.sql", "CREATE TABLE posts (id INT);")
+	writeMigration("0003_likes.sql", "CREATE TABLE likes (id INT);")
+	writeMigration("0004_four.sql", "CREATE TABLE four (id INT);")
+
+	renames, err := Renumber(db, migrationDir)
+	if err != nil {
+		t.Fatalf("Renumber failed: %s", err)
+	}
+	expected := map[string]string{
+		"0002_posts.sql": "0005_posts.sql",
+		"0003_likes.sql": "0006_likes.sql",
+	}
+	if len(renames) != len(expected) {
+		t.Fatalf("Expected %d renames, got %+v", len(expected), renames)
+	}
+	for _, rename := range renames {
+		if expected[filepath.Base(rename.From)] != filepath.Base(rename.To) {
+			t.Fatalf("Unexpected rename %s -> %s", rename.From, rename.To)
+		}
+	}
+	for _, name := range []string{"0002_users.sql", "0003_three.sql", "0004_four.sql", "0005_posts.sql", "0006_likes.sql"} {
+		if _, err := os.Stat(filepath.Join(migrationDir, name)); err != nil {
+			t.Fatalf("Expected %s to exist after renumbering: %s", name, err)
+		}
+	}
+
+	// The migrations apply cleanly afterwards
+	if err := MigrateUp(db, os.DirFS(filepath.Dir(migrationDir)), "migrations"); err != nil {
+		t.Fatalf("MigrateUp after renumbering failed: %s", err)
+	}
+}
+
+func TestRenumberNestedDirectories(t *testing.T) {
+	migrationDir := filepath.Join(t.TempDir(), "migrations")
+	nestedDir := filepath.Join(migrationDir, "billing")
+	if err := os.MkdirAll(nestedDir, 0o755); err != nil {
+		t.Fatalf("Failed to create migrations directory: %s", err)
+	}
+	for _, file := range []string{filepath.Join(migrationDir, "0001_users.sql"), filepath.Join(nestedDir, "0001_invoices.sql")} {
+		if err := os.WriteFile(file, []byte("-- +up\nSELECT 1;\n"), 0o644); err != nil {
+			t.Fatalf("Failed to write migration: %s", err)
+		}
+	}
+	if _, err := listAvailableMigrations(os.DirFS(migrationDir), "."); err == nil {
+		t.Fatalf("Expected the nested duplicate version to be rejected")
+	}
+
+	// The duplicate in the subdirectory is renamed in place
+	renames, err := Renumber(nil, migrationDir)
+	if err != nil {
+		t.Fatalf("Renumber failed: %s", err)
+	}
+	if len(renames) != 1 || renames[0].To != filepath.Join(nestedDir, "0002_invoices.sql") {
+		t.Fatalf("Unexpected renames %+v", renames)
+	}
+	if _, err := listAvailableMigrations(os.DirFS(migrationDir), "."); err != nil {
+		t.Fatalf("Expected unique versions after renumbering: %s", err)
+	}
+}
@@ -0,0 +1,115 @@
+package dbmigrator
+
+import (
+	"fmt"
+	"io/fs"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// splitRepeatableMigrations separates versioned migrations from repeatable migrations
+func splitRepeatableMigrations(migrations []migrationFileInfo) (versioned, repeatable []migrationFileInfo) {
+	for _, migration := range migrations {
+		if migration.repeatable {
+			repeatable = append(repeatable, migration)
+		} else {
+			versioned = append(versioned, migration)
+		}
+	}
+	return versioned, repeatable
+}
+
+// selectAppliedRepeatables returns the checksum of every applied repeatable migration by name.
+// A missing table, such as before the first migration or on databases last migrated
+// by an older release, has none applied.
+func selectAppliedRepeatables(db *queryExecutor) (map[string]string, error) {
+	applied := make(map[string]string)
+	if db.queries.SelectRepeatables == "" {
+		return applied, nil
+	}
+	exists, err := bookkeepingTableExists(db, "repeatable_migrations")
+	if err != nil || !exists {
+		return applied, err
+	}
+	rows, err := db.Query(db.queries.SelectRepeatables)
+	if err != nil {
+		return nil, fmt.Errorf("error reading applied repeatable migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, sum string
+		if err := rows.Scan(&name, &sum); err != nil {
+			return nil, fmt.Errorf("error reading applied repeatable migrations: %w", err)
+		}
+		applied[name] = sum
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading applied repeatable migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// pendingRepeatables loads the contents of the repeatable migrations and
+// returns the ones that were never applied or changed since they were applied.
+func pendingRepeatables(db *queryExecutor, migrationFs fs.FS, repeatables []migrationFileInfo) ([]migrationFileInfo, error) {
+	if len(repeatables) == 0 {
+		return nil, nil
+	}
+	if db.queries.SelectRepeatables == "" {
+		return nil, fmt.Errorf("repeatable migrations are not supported by the active query definition")
+	}
+	applied, err := selectAppliedRepeatables(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []migrationFileInfo
+	for _, migration := range repeatables {
+		if err := loadMigrationContents(migrationFs, &migration); err != nil {
+			return nil, err
+		}
+		if applied[migration.name] != checksum(migration.contents.up) {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// applyRepeatable runs a repeatable migration and records its checksum in a single transaction
+func applyRepeatable(db *queryExecutor, migration *migrationFileInfo) error {
+	log.Printf("Applying repeatable migration %s...\n", migration.name)
+	if db.queries.StatementsOutsideTransaction {
+		if err := execStatements(db, migration.contents, migration.contents.up); err != nil {
+			return fmt.Errorf("error applying repeatable migration (Exec) %s: %w", migration.name, err)
+		}
+	}
+	tx, err := beginMigrationTx(db, migration.contents)
+	if err != nil {
+		return err
+	}
+
+	// Run migration code
+	if !db.queries.StatementsOutsideTransaction {
+		if err := execScript(db.queries, tx, migration.contents.up); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error applying repeatable migration (Exec) %s: %w", migration.name, err)
+		}
+	}
+
+	// Replace the recorded checksum
+	if _, err := tx.Exec(db.queries.DeleteRepeatable, migration.name); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error removing repeatable migration %s: %w", migration.name, err)
+	}
+	_, err = tx.Exec(db.queries.InsertRepeatable, migration.name, checksum(migration.contents.up), time.Now())
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error inserting repeatable migration %s: %w", migration.name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing repeatable migration %s: %w", migration.name, err)
+	}
+	return nil
+}
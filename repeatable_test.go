@@ -0,0 +1,60 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRepeatableMigrationsReapplyOnChange(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_users.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE users (id INT, active INT);\n-- +down\nDROP TABLE users;\n")},
+		"migrations/R_active_users.sql": {Data: []byte(
+			"-- +up\nDROP VIEW IF EXISTS active_users;\nCREATE VIEW active_users AS SELECT id FROM users WHERE active = 1;\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+	assertRepeatablePending(t, db, migrationFs, false)
+
+	// Unchanged repeatable migrations are not applied again
+	if _, err := db.Exec("DROP VIEW active_users"); err != nil {
+		t.Fatalf("Failed to drop view: %s", err)
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='view'").Scan(&count); err != nil || count != 0 {
+		t.Fatalf("Expected unchanged repeatable migration not to run again, found %d views (%v)", count, err)
+	}
+
+	// Changed repeatable migrations are applied again
+	migrationFs["migrations/R_active_users.sql"] = &fstest.MapFile{Data: []byte(
+		"-- +up\nDROP VIEW IF EXISTS active_users;\nCREATE VIEW active_users AS SELECT id, active FROM users WHERE active = 1;\n")}
+	assertRepeatablePending(t, db, migrationFs, true)
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+	if _, err := db.Exec("SELECT id, active FROM active_users"); err != nil {
+		t.Fatalf("Expected changed repeatable migration to be applied: %s", err)
+	}
+	assertRepeatablePending(t, db, migrationFs, false)
+}
+
+// assertRepeatablePending checks the status of the only repeatable migration
+func assertRepeatablePending(t *testing.T, db *sql.DB, migrationFs fstest.MapFS, pending bool) {
+	t.Helper()
+	status, err := Status(db, migrationFs, "migrations")
+	if err != nil {
+		t.Fatalf("Status failed: %s", err)
+	}
+	if len(status.Repeatables) != 1 || status.Repeatables[0].Name != "active_users" {
+		t.Fatalf("Expected repeatable migration active_users in status, got %+v", status.Repeatables)
+	}
+	if status.Repeatables[0].Pending != pending {
+		t.Fatalf("Expected repeatable pending to be %t", pending)
+	}
+}
@@ -0,0 +1,146 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Redo reverts the installed migration and applies it again.
+// Intended for iterating on the latest migration during development.
+func Redo(db *sql.DB, migrationFs fs.FS, migrationDir string) error {
+	return RedoWith(SQLExecutor(db), migrationFs, migrationDir)
+}
+
+// RedoWith works like Redo with queries run by an Executor.
+func RedoWith(db Executor, migrationFs fs.FS, migrationDir string) error {
+	return withMigrationLock(db, func(db *queryExecutor) error {
+		liveState, err := getLiveMigrationInfo(db, migrationFs, migrationDir)
+		if err != nil {
+			return err
+		}
+		if liveState.InstalledVersion == 0 {
+			return errors.New("no migrations to redo")
+		}
+
+		// Make sure the migration can be applied again before reverting it
+		var migration *migrationFileInfo
+		for i := range liveState.Migrations {
+			if liveState.Migrations[i].version == liveState.InstalledVersion {
+				migration = &liveState.Migrations[i]
+				break
+			}
+		}
+		if migration == nil {
+			return fmt.Errorf("failed to find currently installed migration %d", liveState.InstalledVersion)
+		}
+		if err := loadMigrationContents(migrationFs, migration); err != nil {
+			return err
+		}
+
+		if err := migrateDown(db, migrationFs, migrationDir); err != nil {
+			return err
+		}
+		return migrateUpTo(db, migrationFs, migrationDir, migration.version, PhaseAll)
+	})
+}
+
+// Reset reverts every applied migration.
+// Returns ErrConfirmationRequired unless confirmed is true,
+// and ErrIrreversible when reaching a migration that can not be reverted.
+func Reset(db *sql.DB, migrationFs fs.FS, migrationDir string, confirmed bool) error {
+	return ResetWith(SQLExecutor(db), migrationFs, migrationDir, confirmed)
+}
+
+// ResetWith works like Reset with queries run by an Executor.
+func ResetWith(db Executor, migrationFs fs.FS, migrationDir string, confirmed bool) error {
+	if !confirmed {
+		return fmt.Errorf("%w: reset reverts every migration", ErrConfirmationRequired)
+	}
+	if err := MigrateDownToWith(db, migrationFs, migrationDir, 0); err != nil {
+		return err
+	}
+	log.Println("Reset complete.")
+	return nil
+}
+
+// Fresh drops every object in the current schema, including the migration
+// bookkeeping tables and history, and then migrates up from scratch.
+// The migration lock is held throughout, a lock table is kept.
+// Returns ErrConfirmationRequired unless confirmed is true.
+func Fresh(db *sql.DB, migrationFs fs.FS, migrationDir string, confirmed bool) error {
+	return FreshWith(SQLExecutor(db), migrationFs, migrationDir, confirmed)
+}
+
+// FreshWith works like Fresh with queries run by an Executor.
+func FreshWith(db Executor, migrationFs fs.FS, migrationDir string, confirmed bool) error {
+	if !confirmed {
+		return fmt.Errorf("%w: fresh drops every object in the schema", ErrConfirmationRequired)
+	}
+	return withMigrationLock(db, func(db *queryExecutor) error {
+		if err := dropAllObjects(db); err != nil {
+			return err
+		}
+		return migrateUpTo(db, migrationFs, migrationDir, 0, PhaseAll)
+	})
+}
+
+// dropAllObjects drops every object in the current schema using the dialect's introspection query
+func dropAllObjects(db *queryExecutor) error {
+	if db.queries.SelectDropStatements == "" {
+		return errors.New("dropping all objects is not supported by the active query definition")
+	}
+
+	// Session settings such as foreign key checks require a single connection
+	conn, release, err := db.Session()
+	if err != nil {
+		return fmt.Errorf("error getting database connection: %w", err)
+	}
+	defer release()
+
+	statements, err := queryStrings(conn, db.queries.SelectDropStatements)
+	if err != nil {
+		return fmt.Errorf("error listing objects to drop: %w", err)
+	}
+
+	if db.queries.DisableForeignKeyChecks != "" {
+		if _, err := conn.Exec(db.queries.DisableForeignKeyChecks); err != nil {
+			return fmt.Errorf("error disabling foreign key checks: %w", err)
+		}
+		defer func() {
+			if _, err := conn.Exec(db.queries.EnableForeignKeyChecks); err != nil {
+				log.Errorf("Error enabling foreign key checks: %v", err)
+			}
+		}()
+	}
+
+	for _, statement := range statements {
+		log.Debugf("Dropping: %s", statement)
+		if _, err := conn.Exec(statement); err != nil {
+			return fmt.Errorf("error dropping object (%s): %w", statement, err)
+		}
+	}
+	log.Printf("Dropped %d objects.\n", len(statements))
+	return nil
+}
+
+// queryStrings returns the first column of every row of a query
+func queryStrings(conn Executor, query string) ([]string, error) {
+	rows, err := conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,59 @@
+package dbmigrator
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRedoResetFresh(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_two.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE two (id INT);\n-- +down\nDROP TABLE two;\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+
+	// Redo reverts and applies the latest migration again
+	if _, err := db.Exec("INSERT INTO two VALUES (1)"); err != nil {
+		t.Fatalf("Failed to insert: %s", err)
+	}
+	if err := Redo(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("Redo failed: %s", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM two").Scan(&count); err != nil || count != 0 {
+		t.Fatalf("Expected table two to be recreated empty, got %d rows (%v)", count, err)
+	}
+
+	// Destructive operations require confirmation
+	if err := Reset(db, migrationFs, "migrations", false); !errors.Is(err, ErrConfirmationRequired) {
+		t.Fatalf("Expected ErrConfirmationRequired, got %v", err)
+	}
+	if err := Fresh(db, migrationFs, "migrations", false); !errors.Is(err, ErrConfirmationRequired) {
+		t.Fatalf("Expected ErrConfirmationRequired, got %v", err)
+	}
+
+	// Reset reverts everything
+	if err := Reset(db, migrationFs, "migrations", true); err != nil {
+		t.Fatalf("Reset failed: %s", err)
+	}
+	if tableExists(t, db, "one") || tableExists(t, db, "two") {
+		t.Fatalf("Expected reset to revert every migration")
+	}
+
+	// Fresh drops objects unknown to the migrations and migrates up
+	if _, err := db.Exec("CREATE TABLE leftover (id INT); CREATE VIEW leftover_view AS SELECT id FROM leftover"); err != nil {
+		t.Fatalf("Failed to create leftover objects: %s", err)
+	}
+	if err := Fresh(db, migrationFs, "migrations", true); err != nil {
+		t.Fatalf("Fresh failed: %s", err)
+	}
+	if tableExists(t, db, "leftover") || !tableExists(t, db, "one") || !tableExists(t, db, "two") {
+		t.Fatalf("Expected fresh to drop leftover objects and apply every migration")
+	}
+}
@@ -0,0 +1,116 @@
+package dbmigrator
+
+import (
+	"errors"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryPolicy describes how migration transactions failing on a transient error,
+// such as a deadlock or lock timeout, are retried.
+type RetryPolicy struct {
+	Attempts   int           // Total attempts, 1 or less disables retrying
+	Backoff    time.Duration // Delay before the first retry, doubled for each following retry
+	MaxBackoff time.Duration // Upper bound of the delay, 0 for no bound
+	Jitter     float64       // Fraction of the delay randomly added or removed, from 0 to 1
+
+	// Classifier reports whether an error is transient.
+	// Defaults to IsRetryableError with the RetryableErrors of the dialect when nil.
+	Classifier func(err error) bool
+}
+
+// IsRetryableError reports whether err, or an error it wraps, carries one of the
+// error codes of queries.RetryableErrors, such as a SQLSTATE or a driver error number.
+func IsRetryableError(queries *MigrationQueryDefinition, err error) bool {
+	if queries == nil || len(queries.RetryableErrors) == 0 {
+		return false
+	}
+	for ; err != nil; err = errors.Unwrap(err) {
+		if code := errorCode(err); code != "" && slices.Contains(queries.RetryableErrors, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorCode returns the SQLSTATE or error number of a driver error, empty when err has none.
+// Drivers are inspected by method or field name so none of them have to be imported.
+func errorCode(err error) string {
+	switch driverErr := err.(type) {
+	case interface{ SQLState() string }: // lib/pq, pgx
+		return driverErr.SQLState()
+	case interface{ Code() int }: // modernc.org/sqlite
+		return strconv.Itoa(driverErr.Code())
+	}
+
+	value := reflect.ValueOf(err)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return ""
+	}
+	for _, name := range []string{"Number", "Code"} { // go-sql-driver/mysql, go-mssqldb, mattn/go-sqlite3
+		field := value.FieldByName(name)
+		switch {
+		case !field.IsValid():
+		case field.CanInt():
+			return strconv.FormatInt(field.Int(), 10)
+		case field.CanUint():
+			return strconv.FormatUint(field.Uint(), 10)
+		}
+	}
+	return ""
+}
+
+// withRetry runs fn, a whole migration transaction, again while it fails on a transient error
+func withRetry(queries *MigrationQueryDefinition, operation string, fn func() error) error {
+	policy := activeRetryPolicy
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.Attempts || !policy.retryable(queries, err) {
+			return err
+		}
+		delay := policy.delay(attempt)
+		log.Warnf("%s failed on a transient error, retrying in %s (attempt %d of %d): %v",
+			operation, delay, attempt+1, policy.Attempts, err)
+		time.Sleep(delay)
+	}
+}
+
+// runOnce runs fn without retrying, for migrations inside a transaction retried as a whole
+func runOnce(_ string, fn func() error) error {
+	return fn()
+}
+
+// retryable reports whether a failed migration transaction may be retried.
+// Statements run outside a transaction may have been partially applied and are never retried.
+func (policy RetryPolicy) retryable(queries *MigrationQueryDefinition, err error) bool {
+	if queries.StatementsOutsideTransaction {
+		return false
+	}
+	if policy.Classifier != nil {
+		return policy.Classifier(err)
+	}
+	return IsRetryableError(queries, err)
+}
+
+// delay returns the delay before the retry following attempt
+func (policy RetryPolicy) delay(attempt int) time.Duration {
+	delay := policy.Backoff << min(attempt-1, 30)
+	if delay < 0 || (policy.MaxBackoff > 0 && delay > policy.MaxBackoff) {
+		delay = policy.MaxBackoff
+	}
+	if policy.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * policy.Jitter * float64(delay))
+	}
+	return max(delay, 0)
+}
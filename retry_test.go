@@ -0,0 +1,113 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type sqlStateError struct{ code string }
+
+func (e *sqlStateError) Error() string    { return "sqlstate " + e.code }
+func (e *sqlStateError) SQLState() string { return e.code }
+
+type numberError struct{ Number uint16 }
+
+func (e *numberError) Error() string { return fmt.Sprintf("error %d", e.Number) }
+
+type codeError struct{ Code int }
+
+func (e codeError) Error() string { return fmt.Sprintf("code %d", e.Code) }
+
+func TestIsRetryableError(t *testing.T) {
+	for _, test := range []struct {
+		queries   *MigrationQueryDefinition
+		err       error
+		retryable bool
+	}{
+		{PostgreSQL, &sqlStateError{"40P01"}, true},
+		{PostgreSQL, fmt.Errorf("error applying migration: %w", &sqlStateError{"55P03"}), true},
+		{PostgreSQL, &sqlStateError{"42P01"}, false},
+		{MySQL, &numberError{1213}, true},
+		{MySQL, &numberError{1062}, false},
+		{SQLServer, &numberError{1205}, true},
+		{SQLite, codeError{5}, true},
+		{SQLite, codeError{1}, false},
+		{DuckDB, codeError{5}, false},
+		{PostgreSQL, errors.New("deadlock detected"), false},
+	} {
+		if IsRetryableError(test.queries, test.err) != test.retryable {
+			t.Fatalf("Expected retryable %t for %v", test.retryable, test.err)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, expected := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		80: time.Second,
+	} {
+		if delay := policy.delay(attempt); delay != expected {
+			t.Fatalf("Expected delay %s after attempt %d, got %s", expected, attempt, delay)
+		}
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay := policy.delay(1); delay < 50*time.Millisecond || delay > 150*time.Millisecond {
+			t.Fatalf("Expected delay within the jitter, got %s", delay)
+		}
+	}
+}
+
+func TestRetryOnBusyDatabase(t *testing.T) {
+	SetDatabaseType(SQLite)
+	defer SetDatabaseType(nil)
+	SetRetryPolicy(RetryPolicy{Attempts: 10, Backoff: 20 * time.Millisecond})
+	defer SetRetryPolicy(RetryPolicy{Attempts: 1})
+	connStr := "file:" + filepath.Join(t.TempDir(), "busy.db") + "?_busy_timeout=0"
+	db, err := sql.Open("sqlite3", connStr)
+	if err != nil {
+		t.Fatalf("Failed to open database: %s", err)
+	}
+	defer db.Close()
+	if err := ensureMigrationTableExists(bindTestQueries(t, SQLExecutor(db))); err != nil {
+		t.Fatalf("Failed to create migration tables: %s", err)
+	}
+
+	// Another connection holds the write lock for a while
+	blocker, err := sql.Open("sqlite3", connStr)
+	if err != nil {
+		t.Fatalf("Failed to open database: %s", err)
+	}
+	defer blocker.Close()
+	tx, err := blocker.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %s", err)
+	}
+	if _, err := tx.Exec("CREATE TABLE blocking (id INT)"); err != nil {
+		t.Fatalf("Failed to take the write lock: %s", err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = tx.Rollback()
+	}()
+
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("Expected the migration to succeed after retrying, got %s", err)
+	}
+	version, err := getInstalledMigrationVersion(bindTestQueries(t, SQLExecutor(db)))
+	if err != nil || version != 1 {
+		t.Fatalf("Expected version 1, got %d (%v)", version, err)
+	}
+}
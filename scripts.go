@@ -0,0 +1,100 @@
+package dbmigrator
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checksum returns the hex encoded SHA-256 checksum of SQL contents
+func checksum(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
+
+// insertMigrationScript stores the down SQL of a migration being applied
+func insertMigrationScript(queries *MigrationQueryDefinition, tx Tx, migration *migrationFileInfo) error {
+	if queries.InsertMigrationScript == "" {
+		return nil
+	}
+	down := sql.NullString{
+		String: migration.contents.down,
+		Valid:  migration.contents.hasDown,
+	}
+	_, err := tx.Exec(queries.InsertMigrationScript,
+		migration.version,
+		checksum(migration.contents.up),
+		checksum(migration.contents.down),
+		down)
+	if err != nil {
+		return fmt.Errorf("error storing down SQL of migration %d: %w", migration.version, err)
+	}
+	return nil
+}
+
+// selectMigrationScript returns the down SQL stored for a migration.
+// Returns nil when nothing was stored for the version.
+func selectMigrationScript(db *queryExecutor, version int) (*migrationScript, error) {
+	if db.queries.SelectMigrationScript == "" {
+		return nil, nil
+	}
+	var script migrationScript
+	err := db.
+		QueryRow(db.queries.SelectMigrationScript, version).
+		Scan(&script.upChecksum, &script.downChecksum, &script.down)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading stored down SQL of migration %d: %w", version, err)
+	}
+	return &script, nil
+}
+
+// deleteMigrationScript removes the stored down SQL of a reverted migration
+func deleteMigrationScript(queries *MigrationQueryDefinition, tx Tx, version int) error {
+	if queries.DeleteMigrationScript == "" {
+		return nil
+	}
+	if _, err := tx.Exec(queries.DeleteMigrationScript, version); err != nil {
+		return fmt.Errorf("error removing stored down SQL of migration %d: %w", version, err)
+	}
+	return nil
+}
+
+// resolveDownContents picks the down SQL to revert a migration with
+// from the migration file and the stored down SQL, either of which may be nil.
+func resolveDownContents(version int, fileContents *migrationContents, stored *migrationScript) (*migrationContents, error) {
+	var storedContents *migrationContents
+	if stored != nil {
+		storedContents = &migrationContents{
+			down:    stored.down.String,
+			hasDown: stored.down.Valid,
+		}
+	}
+
+	switch {
+	case fileContents == nil && storedContents == nil:
+		return nil, fmt.Errorf("failed to find currently installed migration %d", version)
+	case fileContents == nil:
+		log.Warnf("Migration file %d not found, using down SQL stored when it was applied", version)
+		return storedContents, nil
+	case storedContents == nil:
+		return fileContents, nil
+	}
+
+	if checksum(fileContents.down) == stored.downChecksum && fileContents.hasDown == storedContents.hasDown {
+		return fileContents, nil
+	}
+	if activeDownSource == PreferFileDown {
+		log.Warnf("Down section of migration %d changed since it was applied, using migration file", version)
+		return fileContents, nil
+	}
+	log.Warnf("Down section of migration %d changed since it was applied, using stored down SQL", version)
+	storedContents.sessionSetup = fileContents.sessionSetup
+	storedContents.isolation = fileContents.isolation
+	return storedContents, nil
+}
@@ -0,0 +1,61 @@
+package dbmigrator
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrateDownUsesStoredDownSQL(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_two.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE two (id INT);\n-- +down\nDROP TABLE two;\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+
+	// Revert a migration whose file is no longer deployed
+	delete(migrationFs, "migrations/0002_two.sql")
+	if err := MigrateDown(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateDown without migration file failed: %s", err)
+	}
+	if tableExists(t, db, "two") {
+		t.Fatalf("Expected stored down SQL to drop table two")
+	}
+
+	// Edited down sections are ignored by default
+	migrationFs["migrations/0001_one.sql"] = &fstest.MapFile{Data: []byte(
+		"-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE does_not_exist;\n")}
+	if err := MigrateDown(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateDown with edited migration file failed: %s", err)
+	}
+	if tableExists(t, db, "one") {
+		t.Fatalf("Expected stored down SQL to drop table one")
+	}
+}
+
+func TestMigrateDownPreferFile(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	SetDownSource(PreferFileDown)
+	defer SetDownSource(PreferStoredDown)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+
+	// The file gained a down section after being applied
+	migrationFs["migrations/0001_one.sql"] = &fstest.MapFile{Data: []byte(
+		"-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")}
+	if err := MigrateDown(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateDown failed: %s", err)
+	}
+	if tableExists(t, db, "one") {
+		t.Fatalf("Expected down section of the file to drop table one")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"database/sql"
 	"errors"
+	"fmt"
 	"io/fs"
 	"regexp"
 	"sort"
@@ -16,274 +17,657 @@ import (
 
 // SetDatabaseType sets the active query set to use for migrations.
 // This should be called before other dbmigrator functions when used,
-// but is optional and defaults to MySQL.
+// but is optional: without it the query set is detected from the driver of the database,
+// see DetectDialect. Passing nil restores detection.
 //
 // MigrationQueries describes the queries used by the migrator.
 // You can set up your own or use one of the defaults.
 // Usage: dbmigrator.SetDatabaseType(dbmigrator.Postgres)
 func SetDatabaseType(querySet *MigrationQueryDefinition) {
-	activeQueryDef = querySet
+	configuredQueryDef = querySet
 }
 
 // MigrateUpCh migrates the database up to the latest version
 // Returns: channel that will be closed when the migration is complete
 func MigrateUpCh(db *sql.DB, migrationFs fs.FS, migrationDir string) chan bool {
-	doneChan := make(chan bool)
+	doneChan := make(chan bool, 1)
 	go func() {
-		// Get migration state
-		migrationState := <-GetLiveMigrationInfoCh(db, migrationFs, migrationDir)
-
-		// Check if already up to date
-		if migrationState.InstalledVersion == migrationState.AvailableVersion {
-			log.Printf("Already up to date at version %d.\n", migrationState.InstalledVersion)
-			doneChan <- true
-			close(doneChan)
-			return
-		} else if migrationState.InstalledVersion > migrationState.AvailableVersion {
-			log.Fatalf(
-				"Installed migration version (%d) is higher than highest available migration (%d).",
-				migrationState.InstalledVersion, migrationState.AvailableVersion)
-		} else {
-			log.Printf("Migrating from %d to %d...\n",
-				migrationState.InstalledVersion, migrationState.AvailableVersion)
+		if err := MigrateUp(db, migrationFs, migrationDir); err != nil {
+			log.Fatal(err)
 		}
+		doneChan <- true
+		close(doneChan)
+	}()
+	return doneChan
+}
 
-		// Filter out new migrations to apply and grab their up/down contents
-		var migrationsToApply []migrationFileInfo
-		for _, migration := range migrationState.Migrations {
-			if migration.version > migrationState.InstalledVersion {
-				migrationsToApply = append(migrationsToApply, migration)
-			}
-		}
+// MigrateUp migrates the database up to the latest version
+func MigrateUp(db *sql.DB, migrationFs fs.FS, migrationDir string) error {
+	return MigrateUpWith(SQLExecutor(db), migrationFs, migrationDir)
+}
+
+// MigrateUpWith works like MigrateUp with queries run by an Executor.
+func MigrateUpWith(db Executor, migrationFs fs.FS, migrationDir string) error {
+	return MigrateUpToWith(db, migrationFs, migrationDir, 0)
+}
+
+// MigrateUpTo migrates the database up to the target version.
+// A target of 0 migrates up to the latest version.
+// Repeatable migrations are applied after the versioned migrations.
+// Concurrent migrators wait for each other using the lock strategy of the dialect.
+func MigrateUpTo(db *sql.DB, migrationFs fs.FS, migrationDir string, target int) error {
+	return MigrateUpToWith(SQLExecutor(db), migrationFs, migrationDir, target)
+}
+
+// MigrateUpToWith works like MigrateUpTo with queries run by an Executor.
+func MigrateUpToWith(db Executor, migrationFs fs.FS, migrationDir string, target int) error {
+	return withMigrationLock(db, func(db *queryExecutor) error {
+		return migrateUpTo(db, migrationFs, migrationDir, target, PhaseAll)
+	})
+}
+
+// migrateUpTo migrates the database up to the target version applying the sections of phase
+// while holding the migration lock
+func migrateUpTo(db *queryExecutor, migrationFs fs.FS, migrationDir string, target int, phase Phase) error {
+	if activeAtomicBatch && (!db.queries.TransactionalDDL || db.queries.StatementsOutsideTransaction) {
+		return ErrAtomicBatchUnsupported
+	}
+
+	// Get migration state
+	migrationState, err := getLiveMigrationInfo(db, migrationFs, migrationDir)
+	if err != nil {
+		return err
+	}
+
+	// Find migrations that have not been applied yet
+	migrationsToApply, repeatablesToApply, err := planUp(db, migrationFs, migrationState, target)
+	if err != nil {
+		return err
+	}
 
-		// fill up/down contents concurrently
-		filledChannel := make(chan bool)
-		for i := range migrationsToApply {
-			idx := i
-			go fillMigrationContents(migrationFs, &migrationsToApply[idx], filledChannel)
+	// Check if already up to date
+	if len(migrationsToApply) == 0 && len(repeatablesToApply) == 0 {
+		log.Printf("Already up to date at version %d.\n", migrationState.InstalledVersion)
+		return nil
+	} else if len(migrationsToApply) > 0 {
+		log.Printf("Migrating from %d to %d...\n",
+			migrationState.InstalledVersion, migrationsToApply[len(migrationsToApply)-1].version)
+	}
+
+	// fill up/down contents concurrently
+	filledChannel := make(chan error)
+	for i := range migrationsToApply {
+		idx := i
+		go fillMigrationContents(migrationFs, &migrationsToApply[idx], filledChannel)
+	}
+	for range migrationsToApply {
+		if fillErr := <-filledChannel; fillErr != nil && err == nil {
+			err = fillErr
 		}
-		for range migrationsToApply {
-			<-filledChannel
+	}
+	close(filledChannel)
+	if err != nil {
+		return err
+	}
+	steps := make([]*phaseStep, len(migrationsToApply))
+	for i := range migrationsToApply {
+		migration := &migrationsToApply[i]
+		if err := checkSquashedBaseline(migration, migrationState.AppliedVersions); err != nil {
+			return err
+		}
+		if steps[i], err = planPhaseStep(migration, phase); err != nil {
+			return err
 		}
-		close(filledChannel)
+	}
 
-		// Apply up migrations
-		for _, migration := range migrationsToApply {
-			// Init tx for this migration
-			tx, err := db.Begin()
-			if err != nil {
-				log.Fatalf("Error beginning transaction: %v", err)
-			}
+	if activeAtomicBatch {
+		err = applyAtomicBatch(db, migrationsToApply, steps, repeatablesToApply)
+	} else {
+		_, err = applyPending(db, migrationsToApply, steps, repeatablesToApply,
+			func(operation string, fn func() error) error {
+				return withRetry(db.queries, operation, fn)
+			})
+	}
+	reportVersions(db, migrationState.AvailableVersion)
+	if err != nil {
+		return err
+	}
+	log.Println("Migration complete.")
+	return nil
+}
 
-			// Run migration code
+// applyPending applies the step of each up migration, nil steps are skipped,
+// followed by repeatable migrations, running the transaction of each one through attempt.
+// Returns the versioned or repeatable migration that failed.
+func applyPending(db *queryExecutor, migrations []migrationFileInfo, steps []*phaseStep, repeatables []migrationFileInfo,
+	attempt func(operation string, fn func() error) error) (*migrationFileInfo, error) {
+	// Apply up migrations
+	for i := range migrations {
+		migration, step := &migrations[i], steps[i]
+		if step == nil {
+			continue
+		}
+		if step.prePhase {
+			log.Printf("Applying pre phase of migration %d...\n", migration.version)
+		} else {
 			log.Printf("Applying migration %d...\n", migration.version)
-			_, err = tx.Exec(migration.contents.up)
-			if err != nil {
-				_ = tx.Rollback()
-				log.Fatalf("Error applying migration (Exec) %d: %v", migration.version, err)
-			}
+		}
+		startedAt := time.Now()
+		err := attempt(fmt.Sprintf("Migration %d", migration.version), func() error {
+			return applyMigrationStep(db, migration, step)
+		})
+		operation, sqlChecksum := step.history()
+		recordHistory(db, operation, migration.version, sqlChecksum, startedAt, err)
+		if err != nil {
+			return migration, err
+		}
+	}
 
-			// Insert migration into migrations table
-			_, err = tx.Exec(activeQueryDef.InsertMigration, migration.version, time.Now())
-			if err != nil {
-				_ = tx.Rollback()
-				log.Fatalf("Error inserting migration version into migrations table %d: %v", migration.version, err)
-			}
+	// Apply repeatable migrations after all versioned migrations
+	for i := range repeatables {
+		repeatable := &repeatables[i]
+		startedAt := time.Now()
+		err := attempt(fmt.Sprintf("Repeatable migration %s", repeatable.name), func() error {
+			return applyRepeatable(db, repeatable)
+		})
+		recordHistory(db, HistoryRepeatable, 0, checksum(repeatable.contents.up), startedAt, err)
+		if err != nil {
+			return repeatable, err
+		}
+	}
+	return nil, nil
+}
 
-			// Commit tx
-			err = tx.Commit()
-			if err != nil {
-				log.Fatalf("Error committing migration %d: %v", migration.version, err)
+// applyAtomicBatch applies all pending migrations and their bookkeeping in a single transaction,
+// retrying the whole transaction on transient errors
+func applyAtomicBatch(db *queryExecutor, migrations []migrationFileInfo, steps []*phaseStep,
+	repeatables []migrationFileInfo) error {
+	return withRetry(db.queries, "Atomic batch", func() error {
+		return applyBatchTx(db, migrations, steps, repeatables)
+	})
+}
+
+// applyBatchTx runs a single attempt of an atomic batch
+func applyBatchTx(db *queryExecutor, migrations []migrationFileInfo, steps []*phaseStep, repeatables []migrationFileInfo) error {
+	startedAt := time.Now()
+	tx, err := db.Begin(activeTxOptions)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	txDB := &queryExecutor{Executor: TxExecutor(tx, db.DriverName()), queries: db.queries}
+	failed, err := applyPending(txDB, migrations, steps, repeatables, runOnce)
+	if err != nil {
+		_ = tx.Rollback()
+
+		// The history of the batch was rolled back with it, record the failure on its own
+		for i := range migrations {
+			if failed == &migrations[i] {
+				operation, sqlChecksum := steps[i].history()
+				recordHistory(db, operation, failed.version, sqlChecksum, startedAt, err)
 			}
 		}
-		log.Println("Migration complete.")
-		close(doneChan)
-	}()
-	return doneChan
+		for i := range repeatables {
+			if failed == &repeatables[i] {
+				recordHistory(db, HistoryRepeatable, 0, checksum(failed.contents.up), startedAt, err)
+			}
+		}
+		return fmt.Errorf("atomic batch rolled back, no migrations were applied: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing atomic batch: %w", err)
+	}
+	return nil
 }
 
 // MigrateDownCh migrates the database down to the previous version
 func MigrateDownCh(db *sql.DB, migrationFs fs.FS, migrationDir string) chan bool {
-	doneChan := make(chan bool)
+	doneChan := make(chan bool, 1)
 	go func() {
-		// Get migration state
-		liveState := <-GetLiveMigrationInfoCh(db, migrationFs, migrationDir)
+		if err := MigrateDown(db, migrationFs, migrationDir); err != nil {
+			log.Fatal(err)
+		}
+		doneChan <- true
+		close(doneChan)
+	}()
+	return doneChan
+}
 
-		// Check if any migrations have been applied
-		if liveState.InstalledVersion == 0 {
-			log.Fatal("No migrations to revert.")
+// MigrateDown migrates the database down to the previous version.
+// Returns ErrIrreversible when the installed migration can not be reverted.
+func MigrateDown(db *sql.DB, migrationFs fs.FS, migrationDir string) error {
+	return MigrateDownWith(SQLExecutor(db), migrationFs, migrationDir)
+}
+
+// MigrateDownWith works like MigrateDown with queries run by an Executor.
+func MigrateDownWith(db Executor, migrationFs fs.FS, migrationDir string) error {
+	return withMigrationLock(db, func(db *queryExecutor) error {
+		return migrateDown(db, migrationFs, migrationDir)
+	})
+}
+
+// migrateDown reverts the installed migration while holding the migration lock
+func migrateDown(db *queryExecutor, migrationFs fs.FS, migrationDir string) error {
+	// Get migration state
+	liveState, err := getLiveMigrationInfo(db, migrationFs, migrationDir)
+	if err != nil {
+		return err
+	}
+
+	// Check if any migrations have been applied
+	if liveState.InstalledVersion == 0 {
+		return errors.New("no migrations to revert")
+	}
+
+	// Find index of current m
+	migrationToRevertIdx := -1
+	for i, migration := range liveState.Migrations {
+		if migration.version == liveState.InstalledVersion {
+			migrationToRevertIdx = i
+			break
 		}
+	}
 
-		// Find index of current m
-		migrationToRevertIdx := -1
-		for i, migration := range liveState.Migrations {
-			if migration.version == liveState.InstalledVersion {
-				migrationToRevertIdx = i
-				break
-			}
+	// Get migration contents from the file and the bookkeeping table
+	var fileContents *migrationContents
+	if migrationToRevertIdx != -1 {
+		fileMigration := &liveState.Migrations[migrationToRevertIdx]
+		if err := loadMigrationContents(migrationFs, fileMigration); err != nil {
+			return err
+		}
+		fileContents = fileMigration.contents
+	}
+	stored, err := selectMigrationScript(db, liveState.InstalledVersion)
+	if err != nil {
+		return err
+	}
+	contents, err := resolveDownContents(liveState.InstalledVersion, fileContents, stored)
+	if err != nil {
+		return err
+	}
+	migration := &migrationFileInfo{
+		version:  liveState.InstalledVersion,
+		contents: contents,
+	}
+	if !migration.contents.hasDown {
+		return fmt.Errorf("%w: migration %d", ErrIrreversible, migration.version)
+	}
+	log.Printf("Reverting migration %d", liveState.InstalledVersion)
+
+	startedAt := time.Now()
+	err = withRetry(db.queries, fmt.Sprintf("Reverting migration %d", migration.version), func() error {
+		return revertMigration(db, migration)
+	})
+	recordHistory(db, HistoryDown, migration.version, checksum(migration.contents.down), startedAt, err)
+	reportVersions(db, liveState.AvailableVersion)
+	return err
+}
+
+// applyMigration runs the up section of a migration and records it in a single transaction
+func applyMigration(db *queryExecutor, migration *migrationFileInfo) error {
+	return applyMigrationStep(db, migration, &phaseStep{script: migration.contents.up})
+}
+
+// applyMigrationStep runs the script of a step and records the migration, or its pre phase,
+// in a single transaction
+func applyMigrationStep(db *queryExecutor, migration *migrationFileInfo, step *phaseStep) error {
+	if migration.contents.batch != nil {
+		return applyDataMigration(db, migration)
+	}
+	// The pre or post section of a migration may be empty
+	runScript := strings.TrimSpace(step.script) != ""
+	if runScript && db.queries.StatementsOutsideTransaction {
+		if err := execStatements(db, migration.contents, step.script); err != nil {
+			return migrationExecError(db.queries, migration.version, err)
 		}
+	}
 
-		// Validation
-		if migrationToRevertIdx == -1 {
-			log.Fatalf("Failed to find currently installed migration  %d", liveState.InstalledVersion)
-		} else {
-			log.Printf("Reverting migration %d", liveState.InstalledVersion)
+	// Init tx for this migration
+	tx, err := beginMigrationTx(db, migration.contents)
+	if err != nil {
+		return err
+	}
+
+	// Run migration code
+	if runScript && !db.queries.StatementsOutsideTransaction {
+		if err := execScript(db.queries, tx, step.script); err != nil {
+			_ = tx.Rollback()
+			return migrationExecError(db.queries, migration.version, err)
 		}
+	}
 
-		// Select migration after validation
-		migration := &liveState.Migrations[migrationToRevertIdx]
+	// Record the pre phase, or insert migration into migrations table
+	if step.prePhase {
+		err = recordPrePhase(db.queries, tx, migration)
+	} else {
+		err = recordMigration(db.queries, tx, migration)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
 
-		// Get migration contents
-		filledChannel := make(chan bool)
-		go fillMigrationContents(migrationFs, migration, filledChannel)
-		<-filledChannel
-		close(filledChannel)
+	// Commit tx
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing migration %d: %w", migration.version, err)
+	}
+	return nil
+}
 
-		// Init tx for this migration
-		tx, err := db.Begin()
-		if err != nil {
-			log.Fatalf("Error beginning transaction: %v", err)
+// recordMigration inserts a migration into the migrations table along with its script
+// and removes its recorded phases
+func recordMigration(queries *MigrationQueryDefinition, tx Tx, migration *migrationFileInfo) error {
+	_, err := tx.Exec(queries.InsertMigration, migration.version, time.Now())
+	if err != nil {
+		return fmt.Errorf("error inserting migration version into migrations table %d: %w", migration.version, err)
+	}
+	if err := insertMigrationScript(queries, tx, migration); err != nil {
+		return err
+	}
+	return deletePhases(queries, tx, migration.version)
+}
+
+// revertMigration runs the down section of a migration and removes it in a single transaction
+func revertMigration(db *queryExecutor, migration *migrationFileInfo) error {
+	if db.queries.StatementsOutsideTransaction {
+		if err := execStatements(db, migration.contents, migration.contents.down); err != nil {
+			return migrationExecError(db.queries, migration.version, err)
 		}
+	}
 
-		// Run migration code
-		_, err = tx.Exec(migration.contents.down)
-		if err != nil {
+	// Init tx for this migration
+	tx, err := beginMigrationTx(db, migration.contents)
+	if err != nil {
+		return err
+	}
+
+	// Run migration code
+	if !db.queries.StatementsOutsideTransaction {
+		if err := execScript(db.queries, tx, migration.contents.down); err != nil {
 			_ = tx.Rollback()
-			log.Fatalf("Error applying migration (Exec) %d: %v", migration.version, err)
+			return migrationExecError(db.queries, migration.version, err)
 		}
+	}
 
-		// Insert migration into migrations table
-		_, err = tx.Exec(
-			activeQueryDef.DeleteMigration, migration.version)
-		if err != nil {
-			_ = tx.Rollback()
-			log.Fatalf("Error removing version from migrations table %d: %v", migration.version, err)
+	// Remove migration from migrations table
+	_, err = tx.Exec(
+		db.queries.DeleteMigration, migration.version)
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error removing version from migrations table %d: %w", migration.version, err)
+	}
+	if err = deleteMigrationScript(db.queries, tx, migration.version); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// Commit tx
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing migration %d: %w", migration.version, err)
+	}
+	return nil
+}
+
+// execStatements runs each statement of a migration on its own outside a transaction,
+// on a single connection after the session setup statements of the migration
+func execStatements(db *queryExecutor, contents *migrationContents, script string) error {
+	session, release, err := db.Session()
+	if err != nil {
+		return fmt.Errorf("error getting database connection: %w", err)
+	}
+	defer release()
+	for _, statement := range migrationSessionSetup(contents) {
+		if _, err := session.Exec(statement); err != nil {
+			return fmt.Errorf("error running session setup (%s): %w", statement, err)
+		}
+	}
+	for _, statement := range splitStatements(db.queries.SQLSyntax, script) {
+		if _, err := session.Exec(statement); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		// Commit tx
-		err = tx.Commit()
-		if err != nil {
-			log.Fatalf("Error committing migration %d: %v", migration.version, err)
+// execScript runs a migration script in a transaction,
+// as a single batch of statements when the transaction supports batching
+// and statement by statement when the script changes the terminator with `DELIMITER`
+func execScript(queries *MigrationQueryDefinition, tx Tx, script string) error {
+	split := splitScript(queries.SQLSyntax, script)
+	if batcher, ok := tx.(Batcher); ok {
+		return batcher.ExecBatch(split.statements)
+	}
+	if split.delimiterLines {
+		for _, statement := range split.statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
 		}
-		close(doneChan)
-	}()
-	return doneChan
+		return nil
+	}
+	_, err := tx.Exec(script)
+	return err
+}
+
+// migrationExecError describes a migration whose SQL failed, warning when the dialect
+// could not roll back the schema changes it made before failing
+func migrationExecError(queries *MigrationQueryDefinition, version int, err error) error {
+	if !queries.TransactionalDDL || queries.StatementsOutsideTransaction {
+		return fmt.Errorf("error applying migration (Exec) %d, its schema changes may be partially applied, "+
+			"revert them by hand or complete them and use migrate force: %w", version, err)
+	}
+	return fmt.Errorf("error applying migration (Exec) %d: %w", version, err)
 }
 
 // GetLiveMigrationInfoCh returns the latest migration version and the installed migration version
 func GetLiveMigrationInfoCh(db *sql.DB, migrationFs fs.FS, migrationDir string) chan MigrationState {
 	resultChan := make(chan MigrationState, 1)
 	go func() {
-		log.Debugf("Getting migration info...")
-
-		// Start channels for info io collection
-		installedMigrationChan := getInstalledMigrationVersionCh(db)
-		allMigrationsChan := ListAvailableMigrationsCh(migrationFs, migrationDir)
-
-		// Local migration info
-		allMigrations := <-allMigrationsChan
-		totalMigrationCount := len(allMigrations)
-
-		// Installed migration info
-		installedMigration := <-installedMigrationChan
-
-		// Return
-		if totalMigrationCount == 0 {
-			log.Warn("No database migrations found")
-			resultChan <- MigrationState{
-				AvailableVersion: 0,
-				InstalledVersion: installedMigration,
-				Migrations:       nil,
-			}
-		} else {
-			highestAvailableMigration := allMigrations[totalMigrationCount-1]
-			resultChan <- MigrationState{
-				AvailableVersion: highestAvailableMigration.version,
-				InstalledVersion: installedMigration,
-				Migrations:       allMigrations,
-			}
+		var state MigrationState
+		bound, err := withQueries(SQLExecutor(db))
+		if err == nil {
+			state, err = getLiveMigrationInfo(bound, migrationFs, migrationDir)
+		}
+		if err != nil {
+			log.Fatal(err)
 		}
+		resultChan <- state
 		close(resultChan)
 	}()
 	return resultChan
 }
 
-// ListAvailableMigrationsCh returns a slice of all migration files in the migrations directory
-func ListAvailableMigrationsCh(migrationFs fs.FS, path string) chan []migrationFileInfo {
-	resultChan := make(chan []migrationFileInfo, 1)
-	go func() {
-		// List all valid migration files
-		migrationFiles := make([]string, 0)
-		re := regexp.MustCompile(`.+[\/|\\](\d{4})_\S+\.sql`)
-		err := fs.WalkDir(migrationFs, ".", func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return err
-			}
+// getLiveMigrationInfo returns the latest migration version and the installed migration version
+func getLiveMigrationInfo(db *queryExecutor, migrationFs fs.FS, migrationDir string) (MigrationState, error) {
+	return loadMigrationState(db, migrationFs, migrationDir, true)
+}
 
-			if !d.IsDir() && re.FindStringSubmatch(path) != nil {
-				migrationFiles = append(migrationFiles, path)
-			}
-			return nil
-		})
+// loadMigrationState returns the migration state of the database,
+// creating the migrations table when createTable is set and reading the database only otherwise
+func loadMigrationState(db *queryExecutor, migrationFs fs.FS, migrationDir string, createTable bool) (MigrationState, error) {
+	log.Debugf("Getting migration info...")
+
+	// Local migration info
+	allMigrations, err := listAvailableMigrations(migrationFs, migrationDir)
+	if err != nil {
+		return MigrationState{}, err
+	}
+	versionedMigrations, repeatableMigrations := splitRepeatableMigrations(allMigrations)
+	totalMigrationCount := len(versionedMigrations)
+
+	// Installed migration info
+	var installedMigration int
+	tableExists := true
+	if createTable {
+		installedMigration, err = getInstalledMigrationVersion(db)
+	} else {
+		installedMigration, tableExists, err = readInstalledVersion(db)
+	}
+	if err != nil {
+		return MigrationState{}, err
+	}
+	var appliedVersions, prePhaseVersions []int
+	if tableExists {
+		appliedVersions, err = getAppliedMigrationVersions(db, installedMigration)
 		if err != nil {
-			log.Fatalf("Error reading migrations directory: %v", err)
+			return MigrationState{}, err
 		}
-
-		// Create map of version per file path
-		sortedVersions := make([]int, 0, len(migrationFiles))
-		migrationMap := make(map[int]migrationFileInfo)
-		for _, file := range migrationFiles {
-			matches := re.FindStringSubmatch(file)
-			version, err := strconv.Atoi(matches[1])
-			if err != nil {
-				log.Fatalf("Error parsing migration version: %v", err)
-			}
-
-			// Duplicate version check
-			if _, exists := migrationMap[version]; exists {
-				log.Fatalf("Duplicate migration version: %d", version)
+		// Read-only callers do not create the phases table
+		phasesExist := createTable
+		if !phasesExist {
+			if phasesExist, err = bookkeepingTableExists(db, "migration_phases"); err != nil {
+				return MigrationState{}, err
 			}
-			migrationMap[version] = migrationFileInfo{
-				version: version,
-				file:    file,
+		}
+		if phasesExist {
+			prePhaseVersions, err = getPrePhaseVersions(db)
+			if err != nil {
+				return MigrationState{}, err
 			}
-			sortedVersions = append(sortedVersions, version)
 		}
-		sort.Ints(sortedVersions)
+	}
+
+	// Return
+	state := MigrationState{
+		InstalledVersion: installedMigration,
+		AppliedVersions:  appliedVersions,
+		PrePhaseVersions: prePhaseVersions,
+		Repeatables:      repeatableMigrations,
 
-		// Return slice of sorted migrationFileInfo
-		sortedMigrationFiles := make([]migrationFileInfo, 0, len(migrationFiles))
-		for _, version := range sortedVersions {
-			sortedMigrationFiles = append(sortedMigrationFiles, migrationMap[version])
+		appliedVersionsUnknown: db.queries.SelectAppliedVersions == "",
+	}
+	if totalMigrationCount == 0 {
+		log.Warn("No database migrations found")
+	} else {
+		state.AvailableVersion = versionedMigrations[totalMigrationCount-1].version
+		state.Migrations = versionedMigrations
+	}
+	if activeMetrics != nil {
+		activeMetrics.SetVersions(state.InstalledVersion, state.AvailableVersion)
+	}
+	return state, nil
+}
+
+// ListAvailableMigrationsCh returns a slice of all migration files in the migrations directory.
+// Versioned migrations are sorted by version and followed by repeatable migrations sorted by name.
+func ListAvailableMigrationsCh(migrationFs fs.FS, path string) chan []migrationFileInfo {
+	resultChan := make(chan []migrationFileInfo, 1)
+	go func() {
+		migrations, err := listAvailableMigrations(migrationFs, path)
+		if err != nil {
+			log.Fatal(err)
 		}
-		resultChan <- sortedMigrationFiles
+		resultChan <- migrations
 		close(resultChan)
 	}()
 	return resultChan
 }
 
+// listAvailableMigrations returns a slice of all migration files in the migrations directory.
+// Versioned migrations are sorted by version and followed by repeatable migrations sorted by name.
+func listAvailableMigrations(migrationFs fs.FS, path string) ([]migrationFileInfo, error) {
+	// List all valid migration files
+	migrationFiles, repeatableFiles, err := walkMigrationFiles(migrationFs, path)
+	if err != nil {
+		return nil, err
+	}
+	re := migrationFileRx
+	repeatableRe := repeatableFileRx
+
+	// Create map of version per file path
+	sortedVersions := make([]int, 0, len(migrationFiles))
+	migrationMap := make(map[int]migrationFileInfo)
+	for _, file := range migrationFiles {
+		matches := re.FindStringSubmatch(file)
+		version, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing migration version: %w", err)
+		}
+
+		// Duplicate version check
+		if _, exists := migrationMap[version]; exists {
+			return nil, fmt.Errorf("duplicate migration version: %d", version)
+		}
+		migrationMap[version] = migrationFileInfo{
+			version: version,
+			file:    file,
+		}
+		sortedVersions = append(sortedVersions, version)
+	}
+	sort.Ints(sortedVersions)
+
+	// Return slice of sorted migrationFileInfo
+	sortedMigrationFiles := make([]migrationFileInfo, 0, len(migrationFiles))
+	for _, version := range sortedVersions {
+		sortedMigrationFiles = append(sortedMigrationFiles, migrationMap[version])
+	}
+
+	// Append repeatable migrations sorted by name
+	repeatableMap := make(map[string]migrationFileInfo)
+	sortedNames := make([]string, 0, len(repeatableFiles))
+	for _, file := range repeatableFiles {
+		name := repeatableRe.FindStringSubmatch(file)[1]
+		if _, exists := repeatableMap[name]; exists {
+			return nil, fmt.Errorf("duplicate repeatable migration: %s", name)
+		}
+		repeatableMap[name] = migrationFileInfo{
+			file:       file,
+			name:       name,
+			repeatable: true,
+		}
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+	for _, name := range sortedNames {
+		sortedMigrationFiles = append(sortedMigrationFiles, repeatableMap[name])
+	}
+	return sortedMigrationFiles, nil
+}
+
+// migrationFileRx matches versioned migration files, repeatableFileRx matches repeatable migration files
+var (
+	migrationFileRx  = regexp.MustCompile(`(?:^|.+[\/|\\])(\d{4})_\S+\.sql$`)
+	repeatableFileRx = regexp.MustCompile(`(?:^|.+[\/|\\])R_(\S+)\.sql$`)
+)
+
+// walkMigrationFiles returns the paths of the versioned and repeatable migration files
+// in path and its subdirectories
+func walkMigrationFiles(migrationFs fs.FS, path string) (migrationFiles []string, repeatableFiles []string, err error) {
+	migrationFiles = make([]string, 0)
+	repeatableFiles = make([]string, 0)
+	if path == "" {
+		path = "."
+	}
+	err = fs.WalkDir(migrationFs, path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() && migrationFileRx.FindStringSubmatch(path) != nil {
+			migrationFiles = append(migrationFiles, path)
+		} else if !d.IsDir() && repeatableFileRx.MatchString(path) {
+			repeatableFiles = append(repeatableFiles, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading migrations directory: %w", err)
+	}
+	return migrationFiles, repeatableFiles, nil
+}
+
 // getInstalledMigrationVersionCh returns the currently installed migration version on the database
-func getInstalledMigrationVersionCh(db *sql.DB) chan int {
+func getInstalledMigrationVersionCh(db Executor) chan int {
 	resultChan := make(chan int, 1)
 	go func() {
-		// Ensure migrations table exists
-		ensureMigrationsTableChan := EnsureMigrationTableExistsCh(db)
-		<-ensureMigrationsTableChan
-
-		// Get installed migration version
 		var version int
-		err := db.
-			QueryRow(activeQueryDef.SelectInstalledVersion).
-			Scan(&version)
+		bound, err := withQueries(db)
+		if err == nil {
+			version, err = getInstalledMigrationVersion(bound)
+		}
 		if err != nil {
-			// No migrations applied yet
-			if errors.Is(err, sql.ErrNoRows) {
-				resultChan <- 0
-				close(resultChan)
-				return
-			} else {
-				log.Fatalf("Error getting migration version: %v", err)
-			}
+			log.Fatal(err)
 		}
 		resultChan <- version
 		close(resultChan)
@@ -291,45 +675,201 @@ func getInstalledMigrationVersionCh(db *sql.DB) chan int {
 	return resultChan
 }
 
+// getInstalledMigrationVersion returns the currently installed migration version on the database.
+// The migrations table is created when it does not exist yet.
+func getInstalledMigrationVersion(db *queryExecutor) (int, error) {
+	// Ensure migrations table exists
+	if err := ensureMigrationTableExists(db); err != nil {
+		return 0, err
+	}
+
+	// Get installed migration version
+	var version int
+	err := db.
+		QueryRow(db.queries.SelectInstalledVersion).
+		Scan(&version)
+	if err != nil {
+		// No migrations applied yet
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error getting migration version: %w", err)
+	}
+	return version, nil
+}
+
+// getAppliedMigrationVersions returns every version recorded in the migrations table in ascending order.
+// Query definitions without SelectAppliedVersions are assumed to have every version up to the installed version applied.
+func getAppliedMigrationVersions(db *queryExecutor, installedVersion int) ([]int, error) {
+	if db.queries.SelectAppliedVersions == "" {
+		if installedVersion == 0 {
+			return nil, nil
+		}
+		return []int{installedVersion}, nil
+	}
+
+	rows, err := db.Query(db.queries.SelectAppliedVersions)
+	if err != nil {
+		return nil, fmt.Errorf("error getting applied migration versions: %w", err)
+	}
+	defer rows.Close()
+	var versions []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("error getting applied migration versions: %w", err)
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting applied migration versions: %w", err)
+	}
+	return versions, nil
+}
+
+// pendingMigrations returns the available migrations that have not been applied in version order,
+// along with the versions among them that are lower than the installed version
+// and are not awaiting their post phase.
+func pendingMigrations(state MigrationState) (pending []migrationFileInfo, outOfOrderVersions []int) {
+	applied := make(map[int]bool, len(state.AppliedVersions))
+	for _, version := range state.AppliedVersions {
+		applied[version] = true
+	}
+	prePhaseApplied := make(map[int]bool, len(state.PrePhaseVersions))
+	for _, version := range state.PrePhaseVersions {
+		prePhaseApplied[version] = true
+	}
+	for _, migration := range state.Migrations {
+		if applied[migration.version] {
+			continue
+		}
+		if state.appliedVersionsUnknown && migration.version <= state.InstalledVersion {
+			// Applied versions are unknown, assume every version up to the installed version is applied
+			continue
+		}
+		// A migration awaiting its post phase is expected below the installed version
+		migration.prePhaseApplied = prePhaseApplied[migration.version]
+		pending = append(pending, migration)
+		if migration.version < state.InstalledVersion && !migration.prePhaseApplied {
+			outOfOrderVersions = append(outOfOrderVersions, migration.version)
+		}
+	}
+	return pending, outOfOrderVersions
+}
+
+// formatVersions formats versions as a comma separated list
+func formatVersions(versions []int) string {
+	formatted := make([]string, len(versions))
+	for i, version := range versions {
+		formatted[i] = strconv.Itoa(version)
+	}
+	return strings.Join(formatted, ", ")
+}
+
 // fillMigrationContents fills the up/down contents of a migration
-func fillMigrationContents(fs fs.FS, migration *migrationFileInfo, doneChan chan bool) {
-	upRx := regexp.MustCompile(`(?i)--\s*\+up(\s*)?(.+)?`)     // +up
-	downRx := regexp.MustCompile(`(?i)--\s*\+down(\s*)?(.+)?`) // +down
+// and reports the result on doneChan
+func fillMigrationContents(fs fs.FS, migration *migrationFileInfo, doneChan chan error) {
+	doneChan <- loadMigrationContents(fs, migration)
+}
+
+// loadMigrationContents reads the up/down contents of a migration file
+func loadMigrationContents(fs fs.FS, migration *migrationFileInfo) error {
+	phasedUpRx := regexp.MustCompile(`(?i)--\s*\+up\s+(pre|post)\b`)           // +up pre, +up post
+	upRx := regexp.MustCompile(`(?i)--\s*\+up(\s*)?(.+)?`)                     // +up
+	downRx := regexp.MustCompile(`(?i)--\s*\+down(\s*)?(.+)?`)                 // +down
+	irreversibleRx := regexp.MustCompile(`(?i)--\s*\+irreversible(\s*)?(.+)?`) // +irreversible
+	squashedRx := regexp.MustCompile(`(?i)--\s*\+squashed\s+(\d+)-(\d+)`)      // +squashed 1-10
+	sessionRx := regexp.MustCompile(`(?i)--\s*\+session\s+(.+)`)               // +session SET ...
+	isolationRx := regexp.MustCompile(`(?i)--\s*\+isolation\s+(.+)`)           // +isolation serializable
+	batchRx := regexp.MustCompile(`(?i)--\s*\+batch\b(.*)`)                    // +batch func=name size=1000 pause=1s
 
 	// Read file contents
 	file, err := fs.Open(migration.file)
 	if err != nil {
-		log.Fatalf("Error opening migration file: %v", err)
+		return fmt.Errorf("error opening migration file: %w", err)
 	}
 	defer func() {
 		err := file.Close()
 		if err != nil {
-			log.Fatalf("Error closing migration file: %v", err)
+			log.Errorf("Error closing migration file: %v", err)
 		}
 	}()
 
 	foundUp := false
+	foundUpPre := false
+	foundUpPost := false
 	foundDown := false
+	irreversible := false
+	squashedFrom := 0
+	var sessionSetup []string
+	var isolation *sql.IsolationLevel
+	var batch *batchDirective
 	capturingSection := 0
-	var upContents, downContents strings.Builder
+	var upContents, downContents, upPreContents, upPostContents strings.Builder
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := scanner.Text()
 		// Check for up/down section
-		if upRx.MatchString(line) {
+		if matches := phasedUpRx.FindStringSubmatch(line); matches != nil {
+			if strings.EqualFold(matches[1], string(PhasePre)) {
+				if foundUpPre {
+					return fmt.Errorf("duplicate `-- +up pre` section in migration %d", migration.version)
+				}
+				foundUpPre = true
+				capturingSection = 3
+			} else {
+				if foundUpPost {
+					return fmt.Errorf("duplicate `-- +up post` section in migration %d", migration.version)
+				}
+				foundUpPost = true
+				capturingSection = 4
+			}
+			continue
+		} else if upRx.MatchString(line) {
 			if foundUp {
-				log.Fatalf("Duplicate up section in migration %d", migration.version)
+				return fmt.Errorf("duplicate up section in migration %d", migration.version)
 			}
 			foundUp = true
 			capturingSection = 1
 			continue
 		} else if downRx.MatchString(line) {
 			if foundDown {
-				log.Fatalf("Duplicate down section in migration %d", migration.version)
+				return fmt.Errorf("duplicate down section in migration %d", migration.version)
 			}
 			foundDown = true
 			capturingSection = 2
 			continue
+		} else if irreversibleRx.MatchString(line) {
+			irreversible = true
+			continue
+		} else if matches := squashedRx.FindStringSubmatch(line); matches != nil {
+			squashedFrom, _ = strconv.Atoi(matches[1])
+			continue
+		} else if matches := sessionRx.FindStringSubmatch(line); matches != nil {
+			if capturingSection != 0 {
+				return fmt.Errorf("`-- +session` must be placed before `-- +up` in migration %d", migration.version)
+			}
+			sessionSetup = append(sessionSetup, strings.TrimSpace(matches[1]))
+			continue
+		} else if matches := isolationRx.FindStringSubmatch(line); matches != nil {
+			if capturingSection != 0 {
+				return fmt.Errorf("`-- +isolation` must be placed before `-- +up` in migration %d", migration.version)
+			}
+			level, err := parseIsolationLevel(strings.TrimSpace(matches[1]))
+			if err != nil {
+				return fmt.Errorf("invalid `-- +isolation` in migration %d: %w", migration.version, err)
+			}
+			isolation = &level
+			continue
+		} else if matches := batchRx.FindStringSubmatch(line); matches != nil {
+			if capturingSection != 0 {
+				return fmt.Errorf("`-- +batch` must be placed before `-- +up` in migration %d", migration.version)
+			}
+			batch, err = parseBatchDirective(matches[1])
+			if err != nil {
+				return fmt.Errorf("invalid `-- +batch` in migration %d: %w", migration.version, err)
+			}
+			continue
 		}
 
 		// Capture up/down section contents
@@ -339,47 +879,125 @@ func fillMigrationContents(fs fs.FS, migration *migrationFileInfo, doneChan chan
 		} else if capturingSection == 2 {
 			downContents.WriteString(line)
 			downContents.WriteString("\n")
+		} else if capturingSection == 3 {
+			upPreContents.WriteString(line)
+			upPreContents.WriteString("\n")
+		} else if capturingSection == 4 {
+			upPostContents.WriteString(line)
+			upPostContents.WriteString("\n")
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading migration file %d: %w", migration.version, err)
+	}
 
 	// Validation
-	if !foundUp {
-		log.Fatalf("Missing `-- +up` section in migration %d", migration.version)
+	phased := foundUpPre || foundUpPost
+	if !foundUp && !phased {
+		return fmt.Errorf("missing `-- +up` section in migration %d", migration.version)
 	}
-	if !foundDown {
-		log.Fatalf("Missing `-- +down` section in migration %d", migration.version)
+	if foundUp && phased {
+		return fmt.Errorf("migration %d mixes `-- +up` with `-- +up pre`/`-- +up post` sections", migration.version)
+	}
+	if phased && batch != nil {
+		return fmt.Errorf("batched data migration %d can not have phases", migration.version)
+	}
+	if phased {
+		// The complete up section runs the pre phase followed by the post phase
+		upContents.WriteString(upPreContents.String())
+		upContents.WriteString(upPostContents.String())
+	}
+	if foundDown && irreversible {
+		return fmt.Errorf("migration %d is marked `-- +irreversible` but has a `-- +down` section", migration.version)
 	}
 
 	// Return
 	migration.contents = &migrationContents{
-		up:   upContents.String(),
-		down: downContents.String(),
+		up:           upContents.String(),
+		upPre:        upPreContents.String(),
+		upPost:       upPostContents.String(),
+		phased:       phased,
+		hasUpPre:     foundUpPre,
+		hasUpPost:    foundUpPost,
+		down:         downContents.String(),
+		hasDown:      foundDown,
+		irreversible: irreversible,
+		squashedFrom: squashedFrom,
+		sessionSetup: sessionSetup,
+		isolation:    isolation,
+		batch:        batch,
 	}
-	doneChan <- true
+	return nil
 }
 
 func EnsureMigrationTableExistsCh(db *sql.DB) chan bool {
 	doneChan := make(chan bool, 1)
 	go func() {
-		// Exist check
-		var exists bool
-		err := db.
-			QueryRow(activeQueryDef.CheckTableExists).
-			Scan(&exists)
-		if err != nil {
-			log.Fatalf("Error checking if migrations table exists: %v", err)
+		bound, err := withQueries(SQLExecutor(db))
+		if err == nil {
+			err = ensureMigrationTableExists(bound)
 		}
-
-		// Create on missing
-		if !exists {
-			_, err := db.Exec(activeQueryDef.CreateMigrationsTable)
-			if err != nil {
-				log.Fatalf("Error creating migrations table: %v", err)
-			}
-
+		if err != nil {
+			log.Fatal(err)
 		}
 		doneChan <- true
 		close(doneChan)
 	}()
 	return doneChan
 }
+
+// ensureMigrationTableExists creates the migrations table when it does not exist yet
+func ensureMigrationTableExists(db *queryExecutor) error {
+	// Exist check
+	var exists bool
+	err := db.
+		QueryRow(db.queries.CheckTableExists).
+		Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking if migrations table exists: %w", err)
+	}
+
+	// Create on missing
+	if !exists {
+		_, err := db.Exec(db.queries.CreateMigrationsTable)
+		if err != nil {
+			return fmt.Errorf("error creating migrations table: %w", err)
+		}
+	}
+
+	// Create the table storing down SQL, the query is expected to be idempotent
+	if db.queries.CreateScriptsTable != "" {
+		if _, err := db.Exec(db.queries.CreateScriptsTable); err != nil {
+			return fmt.Errorf("error creating migration scripts table: %w", err)
+		}
+	}
+
+	// Create the repeatable migrations table, the query is expected to be idempotent
+	if db.queries.CreateRepeatablesTable != "" {
+		if _, err := db.Exec(db.queries.CreateRepeatablesTable); err != nil {
+			return fmt.Errorf("error creating repeatable migrations table: %w", err)
+		}
+	}
+
+	// Create the checkpoints table, the query is expected to be idempotent
+	if db.queries.CreateCheckpointsTable != "" {
+		if _, err := db.Exec(db.queries.CreateCheckpointsTable); err != nil {
+			return fmt.Errorf("error creating migration checkpoints table: %w", err)
+		}
+	}
+
+	// Create the phases table, the query is expected to be idempotent
+	if db.queries.CreatePhasesTable != "" {
+		if _, err := db.Exec(db.queries.CreatePhasesTable); err != nil {
+			return fmt.Errorf("error creating migration phases table: %w", err)
+		}
+	}
+
+	// Create the history table, the query is expected to be idempotent
+	if db.queries.CreateHistoryTable != "" {
+		if _, err := db.Exec(db.queries.CreateHistoryTable); err != nil {
+			return fmt.Errorf("error creating migration history table: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package dbmigrator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOptionalDownAndIrreversibleMigrations(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_with_down.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_without_down.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE two (id INT);\n")},
+		"migrations/0003_irreversible.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE three (id INT);\n-- +irreversible dropping would lose data\n")},
+	}
+
+	// Missing down sections do not block applying migrations
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+
+	// Only the migration without an explicit marker is warned about
+	warnings, err := ValidateMigrations(migrationFs, "migrations")
+	if err != nil {
+		t.Fatalf("ValidateMigrations failed: %s", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "Migration 2") {
+		t.Fatalf("Expected a single warning for migration 2, got %v", warnings)
+	}
+
+	// Irreversible migrations are refused and named
+	err = MigrateDown(db, migrationFs, "migrations")
+	if !errors.Is(err, ErrIrreversible) || !strings.Contains(err.Error(), "migration 3") {
+		t.Fatalf("Expected ErrIrreversible for migration 3, got %v", err)
+	}
+	version, err := getInstalledMigrationVersion(bindTestQueries(t, SQLExecutor(db)))
+	if err != nil || version != 3 {
+		t.Fatalf("Expected version 3 to remain installed, got %d (%v)", version, err)
+	}
+}
+
+func TestIrreversibleMigrationWithDownIsInvalid(t *testing.T) {
+	migrationFs := fstest.MapFS{
+		"migrations/0001_conflict.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\n-- +irreversible\n-- +down\nDROP TABLE one;\n")},
+	}
+	if _, err := ValidateMigrations(migrationFs, "migrations"); err == nil {
+		t.Fatalf("Expected migration with both `-- +irreversible` and `-- +down` to be invalid")
+	}
+}
+
+func TestOutOfOrderMigrations(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql":   {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n")},
+		"migrations/0003_three.sql": {Data: []byte("-- +up\nCREATE TABLE three (id INT);\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+
+	// A branch adding 0002 is merged after 0003 was applied
+	migrationFs["migrations/0002_two.sql"] = &fstest.MapFile{Data: []byte("-- +up\nCREATE TABLE two (id INT);\n")}
+	status, err := Status(db, migrationFs, "migrations")
+	if err != nil {
+		t.Fatalf("Status failed: %s", err)
+	}
+	if len(status.OutOfOrderVersions) != 1 || status.OutOfOrderVersions[0] != 2 {
+		t.Fatalf("Expected version 2 to be reported out of order, got %v", status.OutOfOrderVersions)
+	}
+	err = MigrateUp(db, migrationFs, "migrations")
+	if !errors.Is(err, ErrOutOfOrder) || !strings.Contains(err.Error(), "versions 2") {
+		t.Fatalf("Expected ErrOutOfOrder naming version 2, got %v", err)
+	}
+
+	// Allowed out of order migrations are applied
+	SetAllowOutOfOrder(true)
+	defer SetAllowOutOfOrder(false)
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp with out of order migrations allowed failed: %s", err)
+	}
+	if !tableExists(t, db, "two") {
+		t.Fatalf("Expected out of order migration 2 to be applied")
+	}
+	versions, err := getAppliedMigrationVersions(bindTestQueries(t, SQLExecutor(db)), 3)
+	if err != nil || len(versions) != 3 {
+		t.Fatalf("Expected 3 applied versions, got %v (%v)", versions, err)
+	}
+}
+
+func TestAtomicBatch(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	SetAtomicBatch(true)
+	defer SetAtomicBatch(false)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql":   {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_two.sql":   {Data: []byte("-- +up\nCREATE TABLE two (id INT);\n-- +down\nDROP TABLE two;\n")},
+		"migrations/0003_three.sql": {Data: []byte("-- +up\nINSERT INTO missing VALUES (1);\n-- +down\n")},
+	}
+
+	// A failing migration rolls back the whole batch
+	err := MigrateUp(db, migrationFs, "migrations")
+	if err == nil || !strings.Contains(err.Error(), "atomic batch rolled back") {
+		t.Fatalf("Expected the atomic batch to be rolled back, got %v", err)
+	}
+	version, err := getInstalledMigrationVersion(bindTestQueries(t, SQLExecutor(db)))
+	if err != nil || version != 0 {
+		t.Fatalf("Expected no migrations to be applied, got version %d (%v)", version, err)
+	}
+	if tableExists(t, db, "one") || tableExists(t, db, "two") {
+		t.Fatalf("Expected the schema changes of the batch to be rolled back")
+	}
+
+	// The failure is recorded in the history
+	entries, err := History(db)
+	if err != nil {
+		t.Fatalf("History failed: %s", err)
+	}
+	if len(entries) != 1 || entries[0].Version != 3 || entries[0].Success {
+		t.Fatalf("Expected only the failure of migration 3 in the history, got %+v", entries)
+	}
+
+	// The batch applies once the failing migration is fixed
+	migrationFs["migrations/0003_three.sql"] = &fstest.MapFile{Data: []byte("-- +up\nCREATE TABLE three (id INT);\n-- +down\nDROP TABLE three;\n")}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+	version, err = getInstalledMigrationVersion(bindTestQueries(t, SQLExecutor(db)))
+	if err != nil || version != 3 {
+		t.Fatalf("Expected version 3, got %d (%v)", version, err)
+	}
+}
+
+func TestAtomicBatchRequiresTransactionalDDL(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	queries := *SQLite
+	queries.TransactionalDDL = false
+	SetDatabaseType(&queries)
+	SetAtomicBatch(true)
+	defer SetAtomicBatch(false)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); !errors.Is(err, ErrAtomicBatchUnsupported) {
+		t.Fatalf("Expected ErrAtomicBatchUnsupported, got %v", err)
+	}
+	if tableExists(t, db, "one") {
+		t.Fatalf("Expected no migrations to run")
+	}
+}
@@ -0,0 +1,69 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// isolationLevels are the isolation level names accepted by the `-- +isolation` directive
+var isolationLevels = map[string]sql.IsolationLevel{
+	"default":          sql.LevelDefault,
+	"read uncommitted": sql.LevelReadUncommitted,
+	"read committed":   sql.LevelReadCommitted,
+	"write committed":  sql.LevelWriteCommitted,
+	"repeatable read":  sql.LevelRepeatableRead,
+	"snapshot":         sql.LevelSnapshot,
+	"serializable":     sql.LevelSerializable,
+	"linearizable":     sql.LevelLinearizable,
+}
+
+// parseIsolationLevel parses an isolation level name such as "read committed" or "repeatable-read"
+func parseIsolationLevel(name string) (sql.IsolationLevel, error) {
+	normalized := strings.ToLower(strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_'
+	}), " "))
+	level, ok := isolationLevels[normalized]
+	if !ok {
+		return 0, fmt.Errorf("unknown isolation level %q", name)
+	}
+	return level, nil
+}
+
+// migrationSessionSetup returns the session setup statements of a migration,
+// the `-- +session` directives of its file or the configured statements
+func migrationSessionSetup(contents *migrationContents) []string {
+	if contents != nil && contents.sessionSetup != nil {
+		return contents.sessionSetup
+	}
+	return activeSessionSetup
+}
+
+// migrationTxOptions returns the transaction options of a migration,
+// the configured options with the `-- +isolation` directive of its file applied
+func migrationTxOptions(contents *migrationContents) *sql.TxOptions {
+	if contents == nil || contents.isolation == nil {
+		return activeTxOptions
+	}
+	var opts sql.TxOptions
+	if activeTxOptions != nil {
+		opts = *activeTxOptions
+	}
+	opts.Isolation = *contents.isolation
+	return &opts
+}
+
+// beginMigrationTx begins the transaction of a migration and runs its session setup statements in it
+func beginMigrationTx(db *queryExecutor, contents *migrationContents) (Tx, error) {
+	tx, err := db.Begin(migrationTxOptions(contents))
+	if err != nil {
+		return nil, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	for _, statement := range migrationSessionSetup(contents) {
+		if _, err := tx.Exec(statement); err != nil {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("error running session setup (%s): %w", statement, err)
+		}
+	}
+	return tx, nil
+}
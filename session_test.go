@@ -0,0 +1,92 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseIsolationLevel(t *testing.T) {
+	for name, expected := range map[string]sql.IsolationLevel{
+		"serializable":     sql.LevelSerializable,
+		"READ COMMITTED":   sql.LevelReadCommitted,
+		"repeatable-read":  sql.LevelRepeatableRead,
+		"read_uncommitted": sql.LevelReadUncommitted,
+	} {
+		level, err := parseIsolationLevel(name)
+		if err != nil || level != expected {
+			t.Fatalf("Expected %s for %q, got %s (%v)", expected, name, level, err)
+		}
+	}
+	if _, err := parseIsolationLevel("eventual"); err == nil {
+		t.Fatalf("Expected an unknown isolation level to be invalid")
+	}
+}
+
+func TestSessionSetup(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	SetSessionSetup("INSERT INTO setup_log (source) VALUES ('configured')")
+	defer SetSessionSetup()
+	if _, err := db.Exec("CREATE TABLE setup_log (source TEXT)"); err != nil {
+		t.Fatalf("Failed to create table: %s", err)
+	}
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte("-- +up\nCREATE TABLE one (id INT);\n")},
+		"migrations/0002_two.sql": {Data: []byte(
+			"-- +session INSERT INTO setup_log (source) VALUES ('file')\n-- +up\nCREATE TABLE two (id INT);\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+
+	// File directives replace the configured statements
+	rows, err := db.Query("SELECT source FROM setup_log ORDER BY rowid")
+	if err != nil {
+		t.Fatalf("Failed to query setup log: %s", err)
+	}
+	defer rows.Close()
+	var sources []string
+	for rows.Next() {
+		var source string
+		if err := rows.Scan(&source); err != nil {
+			t.Fatalf("Failed to scan setup log: %s", err)
+		}
+		sources = append(sources, source)
+	}
+	if strings.Join(sources, ",") != "configured,file" {
+		t.Fatalf("Expected session setup to run per migration, got %v", sources)
+	}
+}
+
+func TestIsolationDirective(t *testing.T) {
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +isolation serializable\n-- +session SET search_path = app\n-- +up\nCREATE TABLE one (id INT);\n")},
+	}
+	migration := migrationFileInfo{version: 1, file: "migrations/0001_one.sql"}
+	if err := loadMigrationContents(migrationFs, &migration); err != nil {
+		t.Fatalf("Failed to load migration: %s", err)
+	}
+	SetTxOptions(&sql.TxOptions{Isolation: sql.LevelReadCommitted, ReadOnly: true})
+	defer SetTxOptions(nil)
+	opts := migrationTxOptions(migration.contents)
+	if opts.Isolation != sql.LevelSerializable || !opts.ReadOnly {
+		t.Fatalf("Expected the directive to override only the isolation level, got %+v", opts)
+	}
+	if len(migration.contents.sessionSetup) != 1 || migration.contents.sessionSetup[0] != "SET search_path = app" {
+		t.Fatalf("Unexpected session setup %v", migration.contents.sessionSetup)
+	}
+
+	// Directives belong in the header
+	migrationFs["migrations/0001_one.sql"] = &fstest.MapFile{Data: []byte(
+		"-- +up\n-- +isolation serializable\nCREATE TABLE one (id INT);\n")}
+	if err := loadMigrationContents(migrationFs, &migration); err == nil {
+		t.Fatalf("Expected a directive after `-- +up` to be invalid")
+	}
+	migrationFs["migrations/0001_one.sql"] = &fstest.MapFile{Data: []byte(
+		"-- +isolation eventual\n-- +up\nCREATE TABLE one (id INT);\n")}
+	if err := loadMigrationContents(migrationFs, &migration); err == nil {
+		t.Fatalf("Expected an unknown isolation level to be invalid")
+	}
+}
@@ -0,0 +1,173 @@
+package dbmigrator
+
+import (
+	"strings"
+)
+
+// SQLSyntax is how a dialect quotes strings and writes comments,
+// which decides where the statements of a migration end.
+type SQLSyntax string
+
+const (
+	// SyntaxStandard has standard conforming strings, where only a doubled quote escapes a quote
+	// and backslashes only escape in E'...' strings, `--` and `/* */` comments
+	// and Postgres dollar quoted bodies.
+	SyntaxStandard SQLSyntax = ""
+
+	// SyntaxMySQL has backslash escapes in quoted strings, `#` comments
+	// and client side `DELIMITER` commands changing the statement terminator, as in MySQL and MariaDB.
+	SyntaxMySQL SQLSyntax = "mysql"
+)
+
+// splitResult is an SQL script split into its statements
+type splitResult struct {
+	statements     []string
+	delimiterLines bool   // The script changes the terminator with `DELIMITER`, which only clients understand
+	delimiter      string // Terminator at the end of the script
+	unterminatedAt int    // Offset after the last statement when it has no terminator, -1 otherwise
+}
+
+// splitStatements splits an SQL script into its statements on `;`, or the terminator set with `DELIMITER`.
+// Terminators inside quoted strings, quoted identifiers, comments
+// and Postgres dollar quoted bodies do not end a statement.
+// Returned statements are trimmed and do not include the terminator.
+func splitStatements(syntax SQLSyntax, script string) []string {
+	return splitScript(syntax, script).statements
+}
+
+// splitScript splits an SQL script into its statements following the syntax of a dialect
+func splitScript(syntax SQLSyntax, script string) splitResult {
+	result := splitResult{delimiter: ";", unterminatedAt: -1}
+	mysql := syntax == SyntaxMySQL
+	start := 0    // Offset of the current statement
+	codeEnd := -1 // Offset after the last character of the current statement outside comments, -1 when there is none
+	flush := func(end int) {
+		if codeEnd != -1 {
+			result.statements = append(result.statements, strings.TrimSpace(script[start:end]))
+		}
+		codeEnd = -1
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case mysql && codeEnd == -1 && isLineStart(script, i) && hasWordPrefix(script[i:], "delimiter"):
+			// Client side command, such as DELIMITER $$ around stored procedures
+			end := strings.IndexByte(script[i:], '\n')
+			if end == -1 {
+				end = len(script) - i
+			}
+			if fields := strings.Fields(script[i+len("delimiter") : i+end]); len(fields) > 0 {
+				result.delimiter = fields[0]
+			}
+			result.delimiterLines = true
+			i += end
+			start = i
+		case strings.HasPrefix(script[i:], result.delimiter):
+			flush(i)
+			i += len(result.delimiter) - 1
+			start = i + 1
+		case c == '\'' || c == '"' || c == '`':
+			// Quoted string or identifier, doubled quotes escape the quote
+			escapes := (mysql && c != '`') || (c == '\'' && isEscapeStringPrefix(script, i))
+			end := i + 1
+			for end < len(script) {
+				if script[end] == c {
+					if end+1 < len(script) && script[end+1] == c {
+						end += 2
+						continue
+					}
+					break
+				}
+				if script[end] == '\\' && escapes {
+					end++
+				}
+				end++
+			}
+			i = min(end, len(script)-1)
+			codeEnd = i + 1
+		case c == '-' && i+1 < len(script) && script[i+1] == '-' &&
+			(!mysql || i+2 == len(script) || script[i+2] <= ' '),
+			c == '#' && mysql:
+			// Line comment, MySQL requires whitespace after `--`
+			end := strings.IndexByte(script[i:], '\n')
+			if end == -1 {
+				end = len(script) - i
+			}
+			i += end - 1
+		case c == '/' && i+1 < len(script) && script[i+1] == '*':
+			// Block comment, MySQL runs the contents of /*! ... */ and reads hints from /*+ ... */
+			end := strings.Index(script[i+2:], "*/")
+			if end == -1 {
+				end = len(script) - i - 2
+			} else {
+				end += 2
+			}
+			if mysql && i+2 < len(script) && (script[i+2] == '!' || script[i+2] == '+') {
+				codeEnd = i + 2 + end
+			}
+			i += 2 + end - 1
+		case c == '$' && !mysql:
+			// Dollar quoted body such as $$ ... $$ or $fn$ ... $fn$
+			codeEnd = i + 1
+			tagEnd := strings.IndexByte(script[i+1:], '$')
+			if tagEnd == -1 || !isDollarQuoteTag(script[i:i+tagEnd+2]) {
+				continue
+			}
+			tag := script[i : i+tagEnd+2]
+			end := strings.Index(script[i+len(tag):], tag)
+			if end == -1 {
+				end = len(script) - i - len(tag)
+			} else {
+				end += len(tag)
+			}
+			i += len(tag) + end - 1
+			codeEnd = i + 1
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		default:
+			codeEnd = i + 1
+		}
+	}
+	if codeEnd != -1 {
+		result.unterminatedAt = codeEnd
+	}
+	flush(len(script))
+	return result
+}
+
+// isLineStart reports whether only whitespace precedes offset i on its line
+func isLineStart(script string, i int) bool {
+	lineStart := strings.LastIndexByte(script[:i], '\n') + 1
+	return strings.TrimSpace(script[lineStart:i]) == ""
+}
+
+// hasWordPrefix reports whether s starts with word, case insensitive, followed by whitespace
+func hasWordPrefix(s string, word string) bool {
+	return len(s) > len(word) && strings.EqualFold(s[:len(word)], word) &&
+		(s[len(word)] == ' ' || s[len(word)] == '\t')
+}
+
+// isEscapeStringPrefix reports whether the quote at offset i starts a Postgres E'...' string
+func isEscapeStringPrefix(script string, i int) bool {
+	if i == 0 || (script[i-1] != 'E' && script[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !isIdentifierByte(script[i-2])
+}
+
+// isIdentifierByte reports whether b can be part of an unquoted identifier
+func isIdentifierByte(b byte) bool {
+	return b == '_' || b == '$' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+// isDollarQuoteTag reports whether tag is a valid Postgres dollar quote tag such as $$ or $body$
+func isDollarQuoteTag(tag string) bool {
+	for i, r := range tag[1 : len(tag)-1] {
+		isLetter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		isDigit := r >= '0' && r <= '9'
+		if !isLetter && !(isDigit && i > 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package dbmigrator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name     string
+		syntax   SQLSyntax
+		script   string
+		expected []string
+	}{
+		{
+			name:     "simple statements",
+			script:   "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT)",
+			expected: []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name:     "semicolons in strings and identifiers",
+			script:   "INSERT INTO a VALUES ('x;y', 'it''s;');\nSELECT \"a;b\", `c;d` FROM t;",
+			expected: []string{"INSERT INTO a VALUES ('x;y', 'it''s;')", "SELECT \"a;b\", `c;d` FROM t"},
+		},
+		{
+			name:     "semicolons in comments",
+			script:   "-- drop; everything\nSELECT 1; /* a; b */ SELECT 2;\n-- trailing comment;\n",
+			expected: []string{"-- drop; everything\nSELECT 1", "/* a; b */ SELECT 2"},
+		},
+		{
+			name:     "only comments",
+			script:   "SELECT 1;\n/* block\ncomment; */\n-- line\n;",
+			expected: []string{"SELECT 1"},
+		},
+		{
+			name: "dollar quoted function body",
+			script: "CREATE FUNCTION f() RETURNS INT AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql;\n" +
+				"SELECT $$a;b$$, $1;",
+			expected: []string{
+				"CREATE FUNCTION f() RETURNS INT AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql",
+				"SELECT $$a;b$$, $1",
+			},
+		},
+		{
+			name:     "standard conforming strings end at a backslash",
+			script:   "INSERT INTO paths VALUES ('C:\\');\nSELECT 1;",
+			expected: []string{"INSERT INTO paths VALUES ('C:\\')", "SELECT 1"},
+		},
+		{
+			name:     "escape strings",
+			script:   "SELECT E'it\\'s;', e'\\\\';\nSELECT 'E\\';",
+			expected: []string{"SELECT E'it\\'s;', e'\\\\'", "SELECT 'E\\'"},
+		},
+		{
+			name:     "hash is not a comment in standard syntax",
+			script:   "SELECT '{}'::jsonb #> '{a}';\nSELECT 2;",
+			expected: []string{"SELECT '{}'::jsonb #> '{a}'", "SELECT 2"},
+		},
+		{
+			name:     "mysql backslash escapes",
+			syntax:   SyntaxMySQL,
+			script:   "INSERT INTO a VALUES ('it\\'s;', \"say \\\"hi;\\\"\");\nSELECT 2;",
+			expected: []string{"INSERT INTO a VALUES ('it\\'s;', \"say \\\"hi;\\\"\")", "SELECT 2"},
+		},
+		{
+			name:     "mysql hash comments",
+			syntax:   SyntaxMySQL,
+			script:   "# setup; tables\nCREATE TABLE a (id INT); # trailing;\n#only a comment;\n",
+			expected: []string{"# setup; tables\nCREATE TABLE a (id INT)"},
+		},
+		{
+			name:     "mysql double dash needs whitespace",
+			syntax:   SyntaxMySQL,
+			script:   "SELECT 5--1;\n-- comment;\nSELECT 2;",
+			expected: []string{"SELECT 5--1", "-- comment;\nSELECT 2"},
+		},
+		{
+			name:     "mysql executable comments",
+			syntax:   SyntaxMySQL,
+			script:   "/*!40101 SET NAMES utf8mb4 */;\n/* plain */;\nSELECT /*+ NO_ICP(t) */ 1;",
+			expected: []string{"/*!40101 SET NAMES utf8mb4 */", "SELECT /*+ NO_ICP(t) */ 1"},
+		},
+		{
+			name:   "mysql delimiter",
+			syntax: SyntaxMySQL,
+			script: "CREATE TABLE a (id INT);\nDELIMITER $$\n" +
+				"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT '$$'; END$$\n" +
+				"delimiter ;\nSELECT 2;",
+			expected: []string{
+				"CREATE TABLE a (id INT)",
+				"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT '$$'; END",
+				"SELECT 2",
+			},
+		},
+		{
+			name:     "dollars are not quotes in mysql",
+			syntax:   SyntaxMySQL,
+			script:   "SELECT $$a;b$$;",
+			expected: []string{"SELECT $$a", "b$$"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statements := splitStatements(test.syntax, test.script)
+			if !reflect.DeepEqual(statements, test.expected) {
+				t.Fatalf("Expected %q, got %q", test.expected, statements)
+			}
+		})
+	}
+}
+
+func TestSplitScriptTermination(t *testing.T) {
+	tests := []struct {
+		name           string
+		syntax         SQLSyntax
+		script         string
+		delimiterLines bool
+		delimiter      string
+		unterminatedAt int
+	}{
+		{"terminated", SyntaxStandard, "SELECT 1;\n-- done\n", false, ";", -1},
+		{"unterminated", SyntaxStandard, "SELECT 1;\nSELECT 2", false, ";", 18},
+		{"unterminated before comment", SyntaxStandard, "SELECT 1 -- done", false, ";", 8},
+		{"unterminated before hash comment", SyntaxMySQL, "SELECT 1 # done", false, ";", 8},
+		{"restored delimiter", SyntaxMySQL, "DELIMITER //\nSELECT 1//\nDELIMITER ;\n", true, ";", -1},
+		{"custom delimiter", SyntaxMySQL, "DELIMITER //\nSELECT 1", true, "//", 21},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			split := splitScript(test.syntax, test.script)
+			if split.delimiterLines != test.delimiterLines || split.delimiter != test.delimiter ||
+				split.unterminatedAt != test.unterminatedAt {
+				t.Fatalf("Expected delimiter lines %t, delimiter %q, unterminated at %d, got %+v",
+					test.delimiterLines, test.delimiter, test.unterminatedAt, split)
+			}
+		})
+	}
+}
+
+func TestExecScriptWithDelimiterLines(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	queries := *SQLite
+	queries.SQLSyntax = SyntaxMySQL
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %s", err)
+	}
+	script := "DELIMITER //\nCREATE TABLE a (id INT)//\nDELIMITER ;\nCREATE TABLE b (id INT);\n"
+	if err := execScript(&queries, sqlTx{tx}, script); err != nil {
+		_ = tx.Rollback()
+		t.Fatalf("execScript failed: %s", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %s", err)
+	}
+	if !tableExists(t, db, "a") || !tableExists(t, db, "b") {
+		t.Fatalf("Expected the statements around DELIMITER lines to run")
+	}
+}
@@ -0,0 +1,153 @@
+package dbmigrator
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// squashArchiveDir is the directory inside the migrations directory squashed migrations are moved to
+const squashArchiveDir = "archive"
+
+// Squash concatenates the up sections of every migration up to version upTo
+// in migrationDir on disk into a single baseline migration with version upTo.
+// The original migration files are moved to the `archive` directory
+// inside migrationDir with a `.squashed` suffix, so they are no longer discovered.
+//
+// Databases that have every squashed version recorded, including upTo, have the baseline
+// recorded already and never run it. Databases that have only some of them recorded
+// fail to migrate up until they were migrated up to upTo with the original migration files.
+// Migrations with `-- +batch`, `-- +session` or `-- +isolation` directives
+// or `-- +up pre` and `-- +up post` sections can not be squashed.
+// Up sections are terminated following the SQL syntax of the query set set with SetDatabaseType,
+// SyntaxStandard when none is set.
+//
+// Returns: path of the baseline migration file
+func Squash(migrationDir string, upTo int) (string, error) {
+	syntax := SyntaxStandard
+	if configured := configuredQueryDef; configured != nil {
+		syntax = configured.SQLSyntax
+	}
+	return squash(migrationDir, upTo, syntax)
+}
+
+// squash squashes migrations with up sections written in syntax
+func squash(migrationDir string, upTo int, syntax SQLSyntax) (string, error) {
+	migrationFs := os.DirFS(migrationDir)
+	migrations, err := listAvailableMigrations(migrationFs, ".")
+	if err != nil {
+		return "", err
+	}
+
+	// Select and load the migrations to squash
+	var toSquash []migrationFileInfo
+	for _, migration := range migrations {
+		if migration.repeatable || migration.version > upTo {
+			continue
+		}
+		if err := loadMigrationContents(migrationFs, &migration); err != nil {
+			return "", err
+		}
+		if directive := unsquashableDirective(migration.contents); directive != "" {
+			return "", fmt.Errorf("migration %d can not be squashed, the baseline can not keep its %s",
+				migration.version, directive)
+		}
+		toSquash = append(toSquash, migration)
+	}
+	if len(toSquash) < 2 {
+		return "", fmt.Errorf("at least 2 migrations up to version %d are needed to squash", upTo)
+	}
+	last := toSquash[len(toSquash)-1]
+	if last.version != upTo {
+		return "", fmt.Errorf("migration %d does not exist", upTo)
+	}
+	first := toSquash[0]
+	if first.contents.squashedFrom != 0 {
+		first.version = first.contents.squashedFrom
+	}
+
+	// Concatenate up sections, terminating their last statement and restoring the terminator
+	var baseline strings.Builder
+	fmt.Fprintf(&baseline, "-- Squashed baseline of migrations %d to %d\n", first.version, upTo)
+	fmt.Fprintf(&baseline, "-- +squashed %d-%d\n", first.version, upTo)
+	baseline.WriteString("-- +irreversible\n")
+	baseline.WriteString("-- +up\n")
+	for _, migration := range toSquash {
+		fmt.Fprintf(&baseline, "\n-- Migration %s\n", path.Base(migration.file))
+		up := strings.TrimSpace(migration.contents.up)
+		split := splitScript(syntax, up)
+		if split.unterminatedAt != -1 {
+			up = up[:split.unterminatedAt] + split.delimiter + up[split.unterminatedAt:]
+		}
+		baseline.WriteString(up)
+		baseline.WriteString("\n")
+		if split.delimiter != ";" {
+			baseline.WriteString("DELIMITER ;\n")
+		}
+	}
+
+	// Archive the originals
+	archiveDir := filepath.Join(migrationDir, squashArchiveDir)
+	if err := os.MkdirAll(archiveDir, 0o755); err != nil {
+		return "", fmt.Errorf("error creating archive directory: %w", err)
+	}
+	for _, migration := range toSquash {
+		from := filepath.Join(migrationDir, filepath.FromSlash(migration.file))
+		to := filepath.Join(archiveDir, path.Base(migration.file)+".squashed")
+		if err := os.Rename(from, to); err != nil {
+			return "", fmt.Errorf("error archiving migration %d: %w", migration.version, err)
+		}
+	}
+
+	// Write the baseline
+	baselineFile := filepath.Join(migrationDir, fmt.Sprintf("%04d_squashed_baseline.sql", upTo))
+	if err := writeNewFile(baselineFile, baseline.String()); err != nil {
+		return "", err
+	}
+	log.Printf("Squashed %d migrations into %s.\n", len(toSquash), baselineFile)
+	return baselineFile, nil
+}
+
+// unsquashableDirective returns the directive of a migration that only applies to its own file
+// and would be lost or applied to every squashed migration in a baseline, empty when there is none
+func unsquashableDirective(contents *migrationContents) string {
+	switch {
+	case contents.batch != nil:
+		return "`-- +batch` directive"
+	case contents.sessionSetup != nil:
+		return "`-- +session` directive"
+	case contents.isolation != nil:
+		return "`-- +isolation` directive"
+	case contents.phased:
+		return "`-- +up pre` and `-- +up post` sections"
+	default:
+		return ""
+	}
+}
+
+// checkSquashedBaseline fails when a database has only part of the versions
+// of a pending squashed baseline recorded, as the baseline would recreate
+// objects that exist while the remaining squashed migrations were never applied.
+func checkSquashedBaseline(migration *migrationFileInfo, appliedVersions []int) error {
+	if migration.contents.squashedFrom == 0 {
+		return nil
+	}
+	var recorded []int
+	for _, version := range appliedVersions {
+		if version >= migration.contents.squashedFrom && version <= migration.version {
+			recorded = append(recorded, version)
+		}
+	}
+	if len(recorded) > 0 {
+		return fmt.Errorf(
+			"database has versions %s of squashed baseline %d-%d recorded but not %d, "+
+				"migrate it up to %d with the original migration files before using the squashed baseline",
+			formatVersions(recorded), migration.contents.squashedFrom, migration.version,
+			migration.version, migration.version)
+	}
+	return nil
+}
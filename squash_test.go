@@ -0,0 +1,151 @@
+package dbmigrator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeMigrationFiles writes migration files to migrationDir, creating it
+func writeMigrationFiles(t *testing.T, migrationDir string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(migrationDir, 0o755); err != nil {
+		t.Fatalf("Failed to create migrations directory: %s", err)
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(migrationDir, name), []byte(contents), 0o644); err != nil {
+			t.Fatalf("Failed to write migration: %s", err)
+		}
+	}
+}
+
+func TestSquashMigrations(t *testing.T) {
+	root := t.TempDir()
+	originalRoot := t.TempDir()
+	migrationDir := filepath.Join(root, "migrations")
+	files := map[string]string{
+		"0001_one.sql":   "-- +up\nCREATE TABLE one (id INT)\n-- +down\nDROP TABLE one;\n",
+		"0002_two.sql":   "-- +up\nCREATE TABLE two (id INT);\nINSERT INTO two VALUES (1);\n",
+		"0003_three.sql": "-- +up\nCREATE TABLE three (id INT);\n",
+		"0004_four.sql":  "-- +up\nCREATE TABLE four (id INT);\n",
+	}
+	writeMigrationFiles(t, migrationDir, files)
+	writeMigrationFiles(t, filepath.Join(originalRoot, "migrations"), files)
+
+	// A database partially migrated with the original migrations
+	partialDB := openSQLiteTestDB(t)
+	if err := MigrateUpTo(partialDB, os.DirFS(originalRoot), "migrations", 1); err != nil {
+		t.Fatalf("MigrateUpTo failed: %s", err)
+	}
+
+	baselineFile, err := Squash(migrationDir, 3)
+	if err != nil {
+		t.Fatalf("Squash failed: %s", err)
+	}
+	contents, err := os.ReadFile(baselineFile)
+	if err != nil {
+		t.Fatalf("Failed to read baseline: %s", err)
+	}
+	if !strings.Contains(string(contents), "CREATE TABLE one (id INT);\n") {
+		t.Fatalf("Expected unterminated statements to be terminated in the baseline:\n%s", contents)
+	}
+	for _, name := range []string{"0001_one.sql", "0002_two.sql", "0003_three.sql"} {
+		if _, err := os.Stat(filepath.Join(migrationDir, "archive", name+".squashed")); err != nil {
+			t.Fatalf("Expected %s to be archived: %s", name, err)
+		}
+	}
+
+	// Fresh databases run the baseline followed by newer migrations
+	freshDB := openSQLiteTestDB(t)
+	if err := MigrateUp(freshDB, os.DirFS(root), "migrations"); err != nil {
+		t.Fatalf("MigrateUp on fresh database failed: %s", err)
+	}
+	for _, table := range []string{"one", "two", "three", "four"} {
+		if !tableExists(t, freshDB, table) {
+			t.Fatalf("Expected table %s to exist", table)
+		}
+	}
+
+	// Databases that stopped partway through the squashed range can not use the baseline
+	err = MigrateUp(partialDB, os.DirFS(root), "migrations")
+	if err == nil || !strings.Contains(err.Error(), "original migration files") {
+		t.Fatalf("Expected MigrateUp on a partially migrated database to fail, got %v", err)
+	}
+	if tableExists(t, partialDB, "two") || tableExists(t, partialDB, "four") {
+		t.Fatalf("Expected no migrations to run on a partially migrated database")
+	}
+
+	// Once migrated through the squashed range with the originals, the baseline is recorded already
+	if err := MigrateUpTo(partialDB, os.DirFS(originalRoot), "migrations", 3); err != nil {
+		t.Fatalf("MigrateUpTo with the original migrations failed: %s", err)
+	}
+	if err := MigrateUp(partialDB, os.DirFS(root), "migrations"); err != nil {
+		t.Fatalf("MigrateUp after the original migrations failed: %s", err)
+	}
+	if !tableExists(t, partialDB, "four") {
+		t.Fatalf("Expected migration 4 to run")
+	}
+	status, err := Status(partialDB, os.DirFS(root), "migrations")
+	if err != nil || status.InstalledVersion != 4 || len(status.PendingVersions) != 0 {
+		t.Fatalf("Expected version 4 without pending migrations, got %+v (%v)", status, err)
+	}
+}
+
+func TestSquashRefusesFileDirectives(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		migration string
+		directive string
+	}{
+		{"batch", "-- +batch size=10\n-- +up\nUPDATE one SET id = id;\n", "-- +batch"},
+		{"session", "-- +session SET lock_timeout = '1s'\n-- +up\nCREATE TABLE two (id INT);\n", "-- +session"},
+		{"isolation", "-- +isolation serializable\n-- +up\nCREATE TABLE two (id INT);\n", "-- +isolation"},
+		{"phases", "-- +up pre\nCREATE TABLE two (id INT);\n-- +up post\nDROP TABLE one;\n", "-- +up pre"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			migrationDir := filepath.Join(t.TempDir(), "migrations")
+			writeMigrationFiles(t, migrationDir, map[string]string{
+				"0001_one.sql": "-- +up\nCREATE TABLE one (id INT);\n",
+				"0002_two.sql": test.migration,
+			})
+
+			_, err := Squash(migrationDir, 2)
+			if err == nil || !strings.Contains(err.Error(), test.directive) {
+				t.Fatalf("Expected Squash to refuse the %s directive, got %v", test.directive, err)
+			}
+			for _, name := range []string{"0001_one.sql", "0002_two.sql"} {
+				if _, err := os.Stat(filepath.Join(migrationDir, name)); err != nil {
+					t.Fatalf("Expected %s not to be archived: %s", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSquashKeepsMySQLSyntax(t *testing.T) {
+	migrationDir := filepath.Join(t.TempDir(), "migrations")
+	writeMigrationFiles(t, migrationDir, map[string]string{
+		"0001_one.sql":   "-- +up\nCREATE TABLE one (id INT) # no terminator\n",
+		"0002_two.sql":   "-- +up\nDELIMITER $$\nCREATE PROCEDURE two() BEGIN SELECT 1; END$$\n",
+		"0003_three.sql": "-- +up\nCREATE TABLE three (id INT);\n",
+	})
+
+	baselineFile, err := squash(migrationDir, 3, SyntaxMySQL)
+	if err != nil {
+		t.Fatalf("Squash failed: %s", err)
+	}
+	contents := &migrationFileInfo{file: filepath.Base(baselineFile)}
+	if err := loadMigrationContents(os.DirFS(migrationDir), contents); err != nil {
+		t.Fatalf("Failed to load baseline: %s", err)
+	}
+	expected := []string{
+		"-- Migration 0001_one.sql\nCREATE TABLE one (id INT)",
+		"CREATE PROCEDURE two() BEGIN SELECT 1; END",
+		"-- Migration 0003_three.sql\nCREATE TABLE three (id INT)",
+	}
+	if statements := splitStatements(SyntaxMySQL, contents.contents.up); !reflect.DeepEqual(statements, expected) {
+		t.Fatalf("Expected %q, got %q", expected, statements)
+	}
+}
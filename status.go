@@ -0,0 +1,104 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// MigrationStatus summarizes the migrations of a database compared to the available migrations.
+// It is emitted as JSON by `migrate status --format json`, field names are stable.
+type MigrationStatus struct {
+	InstalledVersion   int                `json:"installed_version"`
+	AvailableVersion   int                `json:"available_version"`
+	AppliedVersions    []int              `json:"applied_versions"`
+	PendingVersions    []int              `json:"pending_versions"`
+	OutOfOrderVersions []int              `json:"out_of_order_versions"` // Pending versions lower than the installed version
+	PrePhaseVersions   []int              `json:"pre_phase_versions"`    // Pending versions whose pre phase was applied
+	Repeatables        []RepeatableStatus `json:"repeatables"`
+}
+
+// RepeatableStatus describes a repeatable migration.
+type RepeatableStatus struct {
+	Name    string `json:"name"`
+	File    string `json:"file"`
+	Pending bool   `json:"pending"` // Never applied or changed since it was applied
+}
+
+// Status returns the migration status of the database.
+func Status(db *sql.DB, migrationFs fs.FS, migrationDir string) (MigrationStatus, error) {
+	return StatusWith(SQLExecutor(db), migrationFs, migrationDir)
+}
+
+// StatusWith works like Status with queries run by an Executor.
+func StatusWith(db Executor, migrationFs fs.FS, migrationDir string) (MigrationStatus, error) {
+	bound, err := withQueries(db)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	liveState, err := getLiveMigrationInfo(bound, migrationFs, migrationDir)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	status := MigrationStatus{
+		InstalledVersion: liveState.InstalledVersion,
+		AvailableVersion: liveState.AvailableVersion,
+		AppliedVersions:  append([]int{}, liveState.AppliedVersions...),
+		PendingVersions:  []int{},
+		Repeatables:      []RepeatableStatus{},
+	}
+	pendingVersioned, outOfOrderVersions := pendingMigrations(liveState)
+	for _, migration := range pendingVersioned {
+		status.PendingVersions = append(status.PendingVersions, migration.version)
+	}
+	status.OutOfOrderVersions = append([]int{}, outOfOrderVersions...)
+	status.PrePhaseVersions = append([]int{}, liveState.PrePhaseVersions...)
+
+	pending, err := pendingRepeatables(bound, migrationFs, liveState.Repeatables)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	pendingNames := make(map[string]bool, len(pending))
+	for _, migration := range pending {
+		pendingNames[migration.name] = true
+	}
+	for _, migration := range liveState.Repeatables {
+		status.Repeatables = append(status.Repeatables, RepeatableStatus{
+			Name:    migration.name,
+			File:    migration.file,
+			Pending: pendingNames[migration.name],
+		})
+	}
+	return status, nil
+}
+
+// String formats the status for display on the command line
+func (s MigrationStatus) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Installed version: %d\n", s.InstalledVersion)
+	fmt.Fprintf(&b, "Available version: %d\n", s.AvailableVersion)
+	if len(s.PendingVersions) == 0 {
+		b.WriteString("Pending migrations: none\n")
+	} else {
+		fmt.Fprintf(&b, "Pending migrations: %s\n", formatVersions(s.PendingVersions))
+	}
+	if len(s.OutOfOrderVersions) > 0 {
+		fmt.Fprintf(&b, "Out of order migrations: %s\n", formatVersions(s.OutOfOrderVersions))
+	}
+	if len(s.PrePhaseVersions) > 0 {
+		fmt.Fprintf(&b, "Awaiting post phase: %s\n", formatVersions(s.PrePhaseVersions))
+	}
+	if len(s.Repeatables) > 0 {
+		b.WriteString("Repeatable migrations:\n")
+		for _, repeatable := range s.Repeatables {
+			state := "applied"
+			if repeatable.Pending {
+				state = "pending"
+			}
+			fmt.Fprintf(&b, "  %-40s %s\n", repeatable.Name, state)
+		}
+	}
+	return b.String()
+}
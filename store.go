@@ -1,8 +1,31 @@
 package dbmigrator
 
-func init() {
-	// Set the default query set to MySQL
-	activeQueryDef = MySQL
-}
+import (
+	"database/sql"
+	"time"
+)
 
-var activeQueryDef *MigrationQueryDefinition
+// configuredQueryDef is the query set set with SetDatabaseType, nil to detect it from the driver
+var configuredQueryDef *MigrationQueryDefinition
+
+var activeDownSource = PreferStoredDown
+
+var activeHistoryActor string
+
+var activeAllowOutOfOrder = false
+
+var activeLockTimeout = 10 * time.Minute
+
+var activeAtomicBatch = false
+
+var activeSessionSetup []string
+
+var activeTxOptions *sql.TxOptions
+
+var activeRetryPolicy = RetryPolicy{Attempts: 1}
+
+const defaultBatchSize = 1000
+
+var activeDataMigrationOptions = DataMigrationOptions{BatchSize: defaultBatchSize}
+
+var activeMetrics Metrics
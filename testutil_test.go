@@ -0,0 +1,50 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+var sqliteTestDBCounter atomic.Int64
+
+// openSQLiteTestDB opens a fresh in-memory SQLite database and selects the SQLite query set
+func openSQLiteTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	SetDatabaseType(SQLite)
+	connStr := fmt.Sprintf("file:unit%d.db?cache=shared&mode=memory", sqliteTestDBCounter.Add(1))
+	db, err := sql.Open("sqlite3", connStr)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite database: %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = db.Close()
+		SetDatabaseType(nil)
+	})
+	return db
+}
+
+// tableExists reports whether a table exists in the SQLite test database
+func tableExists(t *testing.T, db *sql.DB, table string) bool {
+	t.Helper()
+	var exists bool
+	err := db.
+		QueryRow("SELECT EXISTS (SELECT name FROM sqlite_master WHERE type='table' AND name=?)", table).
+		Scan(&exists)
+	if err != nil {
+		t.Fatalf("Failed to check if table %s exists: %s", table, err)
+	}
+	return exists
+}
+
+// bindTestQueries binds an executor to the query set resolved for it
+func bindTestQueries(t *testing.T, db Executor) *queryExecutor {
+	t.Helper()
+	bound, err := withQueries(db)
+	if err != nil {
+		t.Fatalf("Failed to resolve query set: %s", err)
+	}
+	return bound
+}
@@ -1,16 +1,42 @@
 package dbmigrator
 
-import "time"
+import (
+	"database/sql"
+	"time"
+)
 
 type migrationFileInfo struct {
-	version  int
-	file     string
-	contents *migrationContents // not always populated
+	version    int    // 0 for repeatable migrations
+	name       string // only set for repeatable migrations
+	repeatable bool
+	file       string
+	contents   *migrationContents // not always populated
+
+	prePhaseApplied bool // the pre phase was applied, the post phase is pending
 }
 
 type migrationContents struct {
-	up   string
-	down string
+	up           string
+	upPre        string // `-- +up pre` section, part of up
+	upPost       string // `-- +up post` section, part of up
+	phased       bool   // the up section is split with `-- +up pre` and `-- +up post`
+	hasUpPre     bool
+	hasUpPost    bool
+	down         string
+	hasDown      bool // false when the file has no `-- +down` section
+	irreversible bool // marked with `-- +irreversible`
+	squashedFrom int  // first version of a squashed baseline marked with `-- +squashed`, 0 otherwise
+
+	sessionSetup []string            // `-- +session` statements, nil to use the configured statements
+	isolation    *sql.IsolationLevel // `-- +isolation` level, nil to use the configured level
+	batch        *batchDirective     // `-- +batch` data migration run in batches, nil otherwise
+}
+
+// migrationScript is the down SQL stored when a migration was applied
+type migrationScript struct {
+	upChecksum   string
+	downChecksum string
+	down         sql.NullString // NULL when the migration had no down section
 }
 
 type MigrationsTable struct {
@@ -21,15 +47,96 @@ type MigrationsTable struct {
 type MigrationState struct {
 	AvailableVersion int
 	InstalledVersion int
+	AppliedVersions  []int // Every version recorded in the migrations table, ascending
+	PrePhaseVersions []int // Versions whose pre phase was applied, awaiting their post phase
 	Migrations       []migrationFileInfo
+	Repeatables      []migrationFileInfo
+
+	// The dialect only reads the installed version, every version up to it is assumed applied
+	appliedVersionsUnknown bool
 }
 
 // MigrationQueries describes the queries used by the migrator.
 // These can be overridden if you want to use a different DB or table name.
 type MigrationQueryDefinition struct {
 	CheckTableExists       string // Expect booly result
+	CheckTableExistsByName string // table name -> booly result, leave empty to assume bookkeeping tables exist
 	CreateMigrationsTable  string
 	InsertMigration        string
 	DeleteMigration        string
 	SelectInstalledVersion string
+	SelectAppliedVersions  string // Every applied version, ascending. Leave empty to only use the installed version.
+	SelectLastApplied      string // -> installed_at of the most recently applied migration, optional
+
+	// Stores the down SQL of applied migrations so they can be reverted
+	// after the migration file changed or was removed.
+	// Leave empty to disable storing down SQL.
+	CreateScriptsTable    string // Must not fail when the table exists
+	InsertMigrationScript string // version, up checksum, down checksum, down SQL
+	SelectMigrationScript string // version -> up checksum, down checksum, down SQL
+	DeleteMigrationScript string // version
+
+	// Append-only log of every migration operation.
+	// Leave empty to disable recording history.
+	CreateHistoryTable string // Must not fail when the table exists
+	InsertHistory      string // version, operation, checksum, actor, started_at, duration_ms, success, error_message
+	SelectHistory      string // -> id, version, operation, checksum, actor, started_at, duration_ms, success, error_message
+	SelectLastHistory  string // -> success of the latest operation
+
+	// Tracks the checksum of applied repeatable migrations.
+	// Leave empty to disable repeatable migrations.
+	CreateRepeatablesTable string // Must not fail when the table exists
+	SelectRepeatables      string // -> name, checksum
+	InsertRepeatable       string // name, checksum, applied_at
+	DeleteRepeatable       string // name
+
+	// Used by Fresh to drop every object in the current schema.
+	// Leave empty to disable Fresh.
+	SelectDropStatements    string // -> DROP statement per object, in the order to execute them
+	DisableForeignKeyChecks string // Optional, executed before dropping
+	EnableForeignKeyChecks  string // Optional, executed after dropping
+
+	// Serializes concurrent migrators. Leave LockStrategy empty to not lock.
+	LockStrategy    LockStrategy
+	CreateLockTable string // LockTable only, must not fail when the table exists
+	AcquireLock     string // LockAdvisory: -> 1 when acquired, 0 while held. LockTable: locked_at, locked_by, fails while held
+	ReleaseLock     string
+
+	// TransactionalDDL declares that schema changes roll back with the transaction they ran in.
+	// When false, a failed migration may leave its schema changes partially applied.
+	TransactionalDDL bool
+
+	// SQLSyntax decides where the statements of a migration end when they run one by one
+	// or in a batch, SyntaxStandard when empty.
+	SQLSyntax SQLSyntax
+
+	// StatementsOutsideTransaction runs each statement of a migration on its own
+	// instead of running the migration in a transaction, for databases where
+	// schema changes in explicit transactions are unreliable.
+	StatementsOutsideTransaction bool
+
+	// Savepoints let each migration run in a caller's transaction roll back on its own.
+	// Leave empty when the database has no savepoints, a failed migration then
+	// requires rolling back the caller's transaction.
+	CreateSavepoint     string // %s is the savepoint name
+	RollbackToSavepoint string // %s is the savepoint name
+	ReleaseSavepoint    string // %s is the savepoint name, optional
+
+	// Stores the progress of batched data migrations so interrupted runs resume.
+	// Leave empty to disable batched data migrations.
+	CreateCheckpointsTable string // Must not fail when the table exists
+	SelectCheckpoint       string // version -> checkpoint, batches, rows_affected
+	InsertCheckpoint       string // version, checkpoint, batches, rows_affected, updated_at
+	DeleteCheckpoint       string // version
+
+	// Records the completed phases of migrations split with `-- +up pre` and `-- +up post`
+	// until they are applied. Leave empty to disable phases.
+	CreatePhasesTable string // Must not fail when the table exists
+	SelectPhases      string // -> version, phase
+	InsertPhase       string // version, phase, applied_at
+	DeletePhases      string // version
+
+	// Error codes of transient errors such as deadlocks and lock timeouts, retried with SetRetryPolicy.
+	// SQLSTATE codes or driver error numbers, see IsRetryableError.
+	RetryableErrors []string
 }
@@ -0,0 +1,40 @@
+package dbmigrator
+
+import (
+	"fmt"
+	"io/fs"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ValidateMigrations parses every migration in the migrations directory
+// without touching the database.
+//
+// Returns: warnings for migrations that are valid but may cause problems,
+// such as migrations without a `-- +down` section that are not explicitly
+// marked `-- +irreversible`. An error is returned for invalid migrations.
+func ValidateMigrations(migrationFs fs.FS, migrationDir string) ([]string, error) {
+	migrations, err := listAvailableMigrations(migrationFs, migrationDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	for i := range migrations {
+		migration := &migrations[i]
+		if err := loadMigrationContents(migrationFs, migration); err != nil {
+			return warnings, err
+		}
+		if migration.repeatable {
+			continue
+		}
+		if !migration.contents.hasDown && !migration.contents.irreversible {
+			warning := fmt.Sprintf(
+				"Migration %d has no `-- +down` section and is not marked `-- +irreversible`",
+				migration.version)
+			log.Warn(warning)
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings, nil
+}
@@ -0,0 +1,131 @@
+package dbmigrator
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// VerifyState is the outcome of verifying a single applied migration.
+type VerifyState string
+
+const (
+	VerifyOK       VerifyState = "ok"       // File matches the applied migration
+	VerifyModified VerifyState = "modified" // File changed since it was applied
+	VerifyMissing  VerifyState = "missing"  // No file for the applied version
+	VerifySquashed VerifyState = "squashed" // Version is part of a squashed baseline
+	VerifyUnknown  VerifyState = "unknown"  // No checksum was stored when it was applied
+)
+
+// MigrationVerification compares an applied migration to its migration file.
+type MigrationVerification struct {
+	Version         int         `json:"version"`
+	File            string      `json:"file,omitempty"`
+	State           VerifyState `json:"state"`
+	AppliedChecksum string      `json:"applied_checksum,omitempty"`
+	FileChecksum    string      `json:"file_checksum,omitempty"`
+}
+
+// VerifyResult lists the verification of every applied migration, lowest version first.
+type VerifyResult struct {
+	Migrations []MigrationVerification `json:"migrations"`
+}
+
+// Valid reports whether no applied migration was modified or is missing
+func (v VerifyResult) Valid() bool {
+	for _, migration := range v.Migrations {
+		if migration.State == VerifyModified || migration.State == VerifyMissing {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify compares the checksum stored when each applied migration was applied
+// to the up section of its migration file, to detect migrations edited after release.
+func Verify(db *sql.DB, migrationFs fs.FS, migrationDir string) (VerifyResult, error) {
+	return VerifyWith(SQLExecutor(db), migrationFs, migrationDir)
+}
+
+// VerifyWith works like Verify with queries run by an Executor.
+func VerifyWith(db Executor, migrationFs fs.FS, migrationDir string) (VerifyResult, error) {
+	bound, err := withQueries(db)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	liveState, err := getLiveMigrationInfo(bound, migrationFs, migrationDir)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	files := make(map[int]*migrationFileInfo, len(liveState.Migrations))
+	for i := range liveState.Migrations {
+		migration := &liveState.Migrations[i]
+		if err := loadMigrationContents(migrationFs, migration); err != nil {
+			return VerifyResult{}, err
+		}
+		files[migration.version] = migration
+	}
+
+	result := VerifyResult{Migrations: []MigrationVerification{}}
+	for _, version := range liveState.AppliedVersions {
+		verification := MigrationVerification{Version: version, State: VerifyOK}
+		migration := files[version]
+		if migration == nil {
+			verification.State = VerifyMissing
+			if isSquashedVersion(liveState.Migrations, version) {
+				verification.State = VerifySquashed
+			}
+			result.Migrations = append(result.Migrations, verification)
+			continue
+		}
+		verification.File = migration.file
+		verification.FileChecksum = checksum(migration.contents.up)
+
+		stored, err := selectMigrationScript(bound, version)
+		if err != nil {
+			return VerifyResult{}, err
+		}
+		switch {
+		case stored == nil:
+			verification.State = VerifyUnknown
+		case stored.upChecksum != verification.FileChecksum:
+			verification.State = VerifyModified
+			verification.AppliedChecksum = stored.upChecksum
+		default:
+			verification.AppliedChecksum = stored.upChecksum
+		}
+		result.Migrations = append(result.Migrations, verification)
+	}
+	return result, nil
+}
+
+// String formats the verification for display on the command line
+func (v VerifyResult) String() string {
+	var b strings.Builder
+	for _, migration := range v.Migrations {
+		file := migration.File
+		if file == "" {
+			file = "-"
+		}
+		fmt.Fprintf(&b, "%04d  %-9s %s\n", migration.Version, migration.State, file)
+	}
+	if v.Valid() {
+		b.WriteString("Applied migrations match their files.\n")
+	} else {
+		b.WriteString("Applied migrations were modified or are missing.\n")
+	}
+	return b.String()
+}
+
+// isSquashedVersion reports whether version is replaced by a squashed baseline migration
+func isSquashedVersion(migrations []migrationFileInfo, version int) bool {
+	for _, migration := range migrations {
+		if migration.contents.squashedFrom != 0 &&
+			version >= migration.contents.squashedFrom && version <= migration.version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package dbmigrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+)
+
+func TestVerify(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_two.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE two (id INT);\n-- +down\nDROP TABLE two;\n")},
+	}
+	if err := MigrateUp(db, migrationFs, "migrations"); err != nil {
+		t.Fatalf("MigrateUp failed: %s", err)
+	}
+
+	result, err := Verify(db, migrationFs, "migrations")
+	if err != nil {
+		t.Fatalf("Verify failed: %s", err)
+	}
+	if !result.Valid() || len(result.Migrations) != 2 || result.Migrations[0].State != VerifyOK {
+		t.Fatalf("Expected unmodified migrations to verify, got %+v", result)
+	}
+
+	// Editing an applied migration is detected
+	migrationFs["migrations/0002_two.sql"] = &fstest.MapFile{Data: []byte(
+		"-- +up\nCREATE TABLE two (id INT, name TEXT);\n-- +down\nDROP TABLE two;\n")}
+	result, err = Verify(db, migrationFs, "migrations")
+	if err != nil {
+		t.Fatalf("Verify failed: %s", err)
+	}
+	if result.Valid() || result.Migrations[1].State != VerifyModified {
+		t.Fatalf("Expected migration 2 to be modified, got %+v", result)
+	}
+
+	// Deleting an applied migration is detected
+	delete(migrationFs, "migrations/0001_one.sql")
+	result, err = Verify(db, migrationFs, "migrations")
+	if err != nil {
+		t.Fatalf("Verify failed: %s", err)
+	}
+	if result.Migrations[0].State != VerifyMissing {
+		t.Fatalf("Expected migration 1 to be missing, got %+v", result)
+	}
+}
+
+func TestJSONOutputSchema(t *testing.T) {
+	db := openSQLiteTestDB(t)
+	migrationFs := fstest.MapFS{
+		"migrations/0001_one.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE one (id INT);\n-- +down\nDROP TABLE one;\n")},
+		"migrations/0002_two.sql": {Data: []byte(
+			"-- +up\nCREATE TABLE two (id INT);\n-- +down\nDROP TABLE two;\n")},
+	}
+	if err := MigrateUpTo(db, migrationFs, "migrations", 1); err != nil {
+		t.Fatalf("MigrateUpTo failed: %s", err)
+	}
+
+	env := commandEnv{db: db, migrationFS: migrationFs, migrationDir: "migrations"}
+	for _, test := range []struct {
+		command string
+		keys    []string
+	}{
+		{"status", []string{"installed_version", "available_version", "applied_versions",
+			"pending_versions", "out_of_order_versions", "pre_phase_versions", "repeatables"}},
+		{"plan", []string{"direction", "from_version", "to_version", "versions", "repeatables"}},
+		{"verify", []string{"migrations"}},
+	} {
+		var out bytes.Buffer
+		env.out = &out
+		if err := findMigrateCommand(test.command).execute(env, []string{"--format", "json"}); err != nil {
+			t.Fatalf("migrate %s failed: %s", test.command, err)
+		}
+		var decoded map[string]any
+		if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+			t.Fatalf("migrate %s emitted invalid JSON: %s\n%s", test.command, err, out.String())
+		}
+		for _, key := range test.keys {
+			if _, ok := decoded[key]; !ok {
+				t.Fatalf("migrate %s JSON is missing %q:\n%s", test.command, key, out.String())
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	env.out = &out
+	if err := findMigrateCommand("history").execute(env, []string{"--format=json"}); err != nil {
+		t.Fatalf("migrate history failed: %s", err)
+	}
+	var entries []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("migrate history emitted invalid JSON: %s\n%s", err, out.String())
+	}
+	if len(entries) != 1 || entries[0]["operation"] != "up" || entries[0]["duration_ms"] == nil {
+		t.Fatalf("Unexpected history JSON:\n%s", out.String())
+	}
+}